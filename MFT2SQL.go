@@ -2,6 +2,7 @@ package main
 
 import "fmt"
 import "os"
+import "io"
 import "bytes"
 import "encoding/binary"
 import "strings"
@@ -13,54 +14,130 @@ import "MFS2SQL/internal"
 import "MFS2SQL/parser"
 import "MFS2SQL/intro"
 
-func iterateMFT(driveLocation string, mftBlockOffset uint64, recordSize int64, ignoreRecords int, NTFSOffset uint32, clusterSize uint32, outputMode int) int{
-	// Note that the first 26 records are reserved for system specific purposes: http://ntfs.com/ntfs-system-files.htm
-	// But this only holds for the first block
-	handle, error := os.Open(driveLocation)
+// Parses a single record slot, slots that don't start with FILE (or BAAD, reported as corrupt) are unused and skipped
+func processRecordSlot(driveLocation string, recordBuffer []byte, recordNumber int64, recordOffset int64, volume internal.VOLUME_INFO, outputMode int) bool{
 	fileIndicator := [4]byte{70, 73, 76, 69}		// Note, this spells out FILE, based on the decimal values for the corresponding character in the ASCII table.
+	badIndicator := [4]byte{66, 65, 65, 68}			// BAAD
 	var tmpMagicNumber [4]byte
-	recordCounter := int64(ignoreRecords)			// the firest 26 contain some unsued ones, will mess up the loop.
+	binary.Read(bytes.NewBuffer(recordBuffer[0:4]), binary.LittleEndian, &tmpMagicNumber)
+	if(tmpMagicNumber != fileIndicator && tmpMagicNumber != badIndicator){
+		return false
+	}
+	fileInformation := parser.ParseMFTRecord(recordBuffer, recordOffset, volume.NTFSOffset, volume.ClusterSize, outputMode)
+	// The position in the $MFT is the record number, the header field only exists since Windows XP (and is gone in torn records)
+	fileInformation.RecordID = uint32(recordNumber)
+	// Extension records only hold attributes of their base record, they are merged into it through its $ATTRIBUTE_LIST.
+	// The base can be record 0 (extension records of the $MFT itself), the sequence number of the reference tells those apart.
+	if(fileInformation.BaseRecord != 0 || fileInformation.BaseSequence != 0){
+		return false
+	}
+	parser.ResolveAttributeList(driveLocation, volume, int64(len(recordBuffer)), &fileInformation)
+	processFileRecord(fileInformation, volume, outputMode)
+	return true
+}
+
+// Visits every record slot within one $MFT data run, an empty or zeroed slot no longer ends the walk
+func iterateMFT(driveLocation string, mftBlock internal.DATA_RUN, firstRecordNumber int64, recordsInBlock int64, recordSize int64, volume internal.VOLUME_INFO, outputMode int) (int, int){
+	const recordsPerRead = 1024		// Read 1024 records (1MB) at once, instead of seeking for every record
+	parsedRecords := 0
+	skippedRecords := 0
+	handle, error := os.Open(driveLocation)
 	if(error == nil){
-		// Initialize first record
-		recordOffset := int64(mftBlockOffset) + int64((recordCounter * recordSize))
-		mftRecordBuffer := make([]byte, recordSize)
-		handle.Seek(recordOffset,0)		
-		handle.Read(mftRecordBuffer)
-		binary.Read(bytes.NewBuffer(mftRecordBuffer[0:4]), binary.LittleEndian, &tmpMagicNumber)
-
-		for(tmpMagicNumber == fileIndicator){
-			// Load next record
-			recordCounter +=1
-			recordOffset := int64(mftBlockOffset) + int64((recordCounter * recordSize))
-			handle.Seek(recordOffset,0)
-			handle.Read(mftRecordBuffer)
-			processFileRecord(parser.ParseMFTRecord(mftRecordBuffer, recordOffset, NTFSOffset, clusterSize, outputMode), outputMode)
-			binary.Read(bytes.NewBuffer(mftRecordBuffer[0:4]), binary.LittleEndian, &tmpMagicNumber)
+		blockOffset := int64(volume.NTFSOffset) + mftBlock.AbsoluteOffsetWithinNTFSPartition
+		readBuffer := make([]byte, recordsPerRead*recordSize)
+		for recordIndex := int64(0); recordIndex < recordsInBlock; recordIndex += recordsPerRead {
+			recordsToRead := recordsInBlock - recordIndex
+			if(recordsToRead > recordsPerRead){
+				recordsToRead = recordsPerRead
+			}
+			handle.Seek(blockOffset + recordIndex*recordSize, 0)
+			bytesRead, _ := io.ReadFull(handle, readBuffer[:recordsToRead*recordSize])
+			for slot := int64(0); slot < recordsToRead; slot++ {
+				recordBuffer := readBuffer[slot*recordSize:(slot+1)*recordSize]
+				recordOffset := blockOffset + (recordIndex+slot)*recordSize
+				if(int64(bytesRead) < (slot+1)*recordSize || !processRecordSlot(driveLocation, recordBuffer, firstRecordNumber+recordIndex+slot, recordOffset, volume, outputMode)){
+					skippedRecords++
+					continue
+				}
+				parsedRecords++
+			}
 		}
 	}
 	handle.Close()
-	return int(recordCounter)
+	return parsedRecords, skippedRecords
 }
 
 
 // *** Support drive specific
-func identifyBasicPartition(partitionArray []internal.PARTITIONENTRY, basicPartionGUID [16]byte) (bool, int){
+// Every partition is a candidate volume, the NTFS header check (OemID) decides which ones are actually NTFS.
+// This also picks up data volumes, a second Windows install and recovery partitions.
+func listGPTPartitionCandidates(partitionArray []internal.PARTITIONENTRY) []internal.VOLUME_INFO{
+	var candidates []internal.VOLUME_INFO
 	for partitionNumber, partition := range partitionArray{
-		if partition.PartitionGUID == basicPartionGUID{
-			return true, partitionNumber
-		}
+		var volume internal.VOLUME_INFO
+		volume.PartitionIndex = partitionNumber
+		volume.PartitionType = internal.FormatGUID(partition.PartitionGUID)
+		volume.PartitionGUID = internal.FormatGUID(partition.UniquePartitionGUID)
+		volume.NTFSOffset = logicalBlockAddressSize * partition.StartingLBA
+		candidates = append(candidates, volume)
+	}
+	return candidates
+}
+
+// 0x07 is shared between NTFS and exFAT (and 0x27 is a hidden recovery partition), so don't filter on type here either
+func listMBRPartitionCandidates(partitionArray []internal.MBRPARTITIONENTRY) []internal.VOLUME_INFO{
+	var candidates []internal.VOLUME_INFO
+	for partitionNumber, partition := range partitionArray{
+		var volume internal.VOLUME_INFO
+		volume.PartitionIndex = partitionNumber
+		volume.PartitionType = fmt.Sprintf("0x%02x", partition.PartitionType)
+		volume.NTFSOffset = logicalBlockAddressSize * uint64(partition.StartingLBA)
+		candidates = append(candidates, volume)
 	}
-	return false,0
+	return candidates
 }
 
 // *** User functionality *** /
 /* Output modus: 1 = Write to screen, 2=Create SQL DB*/
-func processFileRecord(fileInformation internal.FILE_INFO, outputMode int){
+func processFileRecord(fileInformation internal.FILE_INFO, volume internal.VOLUME_INFO, outputMode int){
 	if(outputMode == 1){
-		fmt.Printf("Finished Filename: %s. \n isActive: %t \n isFolder: %t \nStarting at: %d with size: %d\nParent directory: :d", fileInformation.FileName, fileInformation.IsActive, fileInformation.IsFolder,fileInformation.FullDataOffset,fileInformation.DataLength, fileInformation.ParentDirectory)
+		startingAt := fmt.Sprintf("%d", fileInformation.FullDataOffset)
+		// Without a boot sector the cluster size is unknown, only the cluster number of non-resident data means something
+		if(volume.StandaloneMFT && fileInformation.HasDataRun){
+			startingAt = fmt.Sprintf("cluster %d", fileInformation.DataCluster)
+		}
+		fmt.Printf("Finished Filename: %s. \n volume: %d \n isActive: %t \n isCorrupt: %t \n isFolder: %t \nStarting at: %s with size: %d in %d data run(s)\nParent directory: %d (sequence %d)\n", fileInformation.FileName, volume.VolumeID, fileInformation.IsActive, fileInformation.IsCorrupt, fileInformation.IsFolder,startingAt,fileInformation.DataLength, len(fileInformation.DataRuns), fileInformation.ParentDirectory, fileInformation.ParentSequence)
+		fmt.Printf(" Created: %s (FN: %s) \n Modified: %s (FN: %s) \n MFT modified: %s (FN: %s) \n Accessed: %s (FN: %s)\n",
+			internal.FiletimeToISO8601(fileInformation.FileCreatedUTCWinFileEpoch), internal.FiletimeToISO8601(fileInformation.FileNameCreatedUTCWinFileEpoch),
+			internal.FiletimeToISO8601(fileInformation.FileModifiedUTCWinFileEpoch), internal.FiletimeToISO8601(fileInformation.FileNameModifiedUTCWinFileEpoch),
+			internal.FiletimeToISO8601(fileInformation.FileRecordModifiedUTCWinFileEpoch), internal.FiletimeToISO8601(fileInformation.FileNameRecordModifiedUTCWinFileEpoch),
+			internal.FiletimeToISO8601(fileInformation.FileLastReadUTCWinFileEpoch), internal.FiletimeToISO8601(fileInformation.FileNameLastReadUTCWinFileEpoch))
+		for _, fileName := range fileInformation.FileNames{
+			fmt.Printf(" Name: %s (%s), parent directory: %d\n", fileName.Name, internal.NamespaceToString(fileName.Namespace), fileName.ParentDirectory)
+		}
+		if(fileInformation.IsCompressed){
+			fmt.Println(" Compressed: LZNT1")
+		}
+		if(fileInformation.IsWofCompressed){
+			fmt.Println(" Compressed: WOF", internal.WofAlgorithmToString(fileInformation.WofAlgorithm))
+		}
+		if(fileInformation.HasReparsePoint && fileInformation.ReparsePoint.TargetPath != ""){
+			fmt.Printf(" Reparse point: %s -> %s\n", internal.ReparsePointToString(fileInformation.ReparsePoint), fileInformation.ReparsePoint.TargetPath)
+		} else if(fileInformation.HasReparsePoint){
+			fmt.Println(" Reparse point:", internal.ReparsePointToString(fileInformation.ReparsePoint))
+		}
+		if securityDescriptor, ok := volume.SecurityDescriptors[fileInformation.SecurityID]; ok{
+			fmt.Printf(" Owner: %s, security: %s\n", internal.SIDToName(securityDescriptor.OwnerSID), securityDescriptor.SDDL)
+		}
+		for _, dataStream := range fileInformation.Streams{
+			fmt.Printf(" Stream: %s, resident: %t, compressed: %t, size: %d in %d data run(s)\n", dataStream.Name, dataStream.IsResident, dataStream.IsCompressed, dataStream.DataLength, len(dataStream.DataRuns))
+		}
+		if(fileInformation.HasMarkOfTheWeb){
+			fmt.Printf(" Mark of the Web: zone %s, host URL: %s, referrer URL: %s\n", internal.ZoneIDToString(fileInformation.MarkOfTheWeb.ZoneID), fileInformation.MarkOfTheWeb.HostUrl, fileInformation.MarkOfTheWeb.ReferrerUrl)
+		}
 	}
 	if(outputMode == 2){
-		db.InsertFileRecord(int(fileInformation.RecordID), fileInformation.FileName, int(fileInformation.ParentDirectory), internal.BoolToInt(fileInformation.IsFolder), internal.BoolToInt(fileInformation.IsActive), int(fileInformation.FullDataOffset), int(fileInformation.DataLength))
+		db.InsertFileRecord(volume, fileInformation)
 	}
 }
 
@@ -78,18 +155,241 @@ func dumpToFile(deviceLocation string, offset int, length int, outputFile string
 	physicalDiskHandle.Close()
 }
 
-/* MFT to DB or File functionality */
-func dumpMFT(deviceLocation string, dumpMode int){
-	const logicalBlockAddressSize = 512
-	const GPTLBA = 1									//we need the first LBA, LBA0 is legacy	
-	
-	// Typical GUIDs: https://learn.microsoft.com/en-us/windows/win32/api/winioctl/ns-winioctl-partition_information_gpt
-	// We are searching for: ebd0a0a2-b9e5-4433-87c0-68b6b72699c7
-	NTFSSearchGUID := [16]byte{162, 160, 208, 235, 229, 185, 51, 68, 135, 192, 104, 182, 183, 38, 153, 199} 
-	NTFSOEMIndicator := [8]byte{78, 84, 70, 83, 32, 32, 32, 32}
+// Records of a standalone $MFT file only point to clusters of a disk that isn't there
+func hasDiskToCarveFrom(volume internal.VOLUME_INFO) bool{
+	if(volume.StandaloneMFT){
+		fmt.Println("[!] Database was built from a standalone $MFT file, there is no disk to carve from")
+		return false
+	}
+	return true
+}
+
+// Reading a physical disk requires administrator privileges, image files only need read access
+func canReadDisk(deviceLocation string) bool{
+	if(internal.IsPhysicalDevice(deviceLocation) && !internal.IsAdmin()){
+		fmt.Println("[!] This tool must be run with administrative privileges.")
+		return false
+	}
+	return validateInput(deviceLocation)
+}
+
+// Reassembles a file from its run list, so fragmented and sparse files come out byte-exact
+func carveFile(deviceLocation string, volume internal.VOLUME_INFO, fileInformation internal.FILE_INFO, outputFile string) bool{
+	// Resident data lives inside the MFT record itself, it was captured from the record buffer after the fixups were applied
+	if(fileInformation.IsResident && fileInformation.ResidentData != nil){
+		fmt.Printf("[+] Writing %d bytes of resident data of %s (volume %d, RID %d) into file: %s\n", len(fileInformation.ResidentData), fileInformation.FileName, volume.VolumeID, fileInformation.RecordID, outputFile)
+		if err := os.WriteFile(outputFile, fileInformation.ResidentData, 0644); err != nil {
+			fmt.Println("[!] Unable to write output file:", err)
+			return false
+		}
+		return true
+	}
+	if(fileInformation.IsWofCompressed){
+		return carveWofFile(deviceLocation, volume, fileInformation, outputFile)
+	}
+	// The same database could be pointed at the wrong disk or image, the serial number gives that away
+	ntfsHeader := parser.ParseNTFSHeader(deviceLocation, volume.NTFSOffset, 512)
+	if(ntfsHeader.VolumeSerialNumber != volume.VolumeSerialNumber){
+		fmt.Printf("[!] Warning: serial number on disk (%016X) doesn't match volume %d (%016X), is this the right input?\n", ntfsHeader.VolumeSerialNumber, volume.VolumeID, volume.VolumeSerialNumber)
+	}
+	// Nothing to follow, the stored offset is all there is
+	if(len(fileInformation.DataRuns) == 0){
+		dumpToFile(deviceLocation, int(fileInformation.FullDataOffset), int(fileInformation.DataLength), outputFile)
+		return true
+	}
+
+	fmt.Printf("[+] Dumping %s (volume %d, RID %d) from %d data run(s), size: %d into file: %s\n", fileInformation.FileName, volume.VolumeID, fileInformation.RecordID, len(fileInformation.DataRuns), fileInformation.DataLength, outputFile)
+	outputHandle, err := os.Create(outputFile)
+	if err != nil {
+		fmt.Println("[!] Unable to create output file:", err)
+		return false
+	}
+	defer outputHandle.Close()
+	var bytesWritten uint64
+	if(fileInformation.IsCompressed){
+		fmt.Printf("  --> File is NTFS compressed, decompressing LZNT1 compression units of %d clusters\n", fileInformation.CompressionUnit)
+		bytesWritten, err = parser.ReadCompressedDataRuns(deviceLocation, fileInformation.DataRuns, volume.NTFSOffset, volume.ClusterSize, int64(fileInformation.CompressionUnit), fileInformation.DataLength, outputHandle)
+	} else{
+		bytesWritten, err = parser.ReadDataRuns(deviceLocation, fileInformation.DataRuns, volume.NTFSOffset, volume.ClusterSize, fileInformation.DataLength, outputHandle)
+	}
+	if err != nil {
+		fmt.Println("[!] Carving failed after", bytesWritten, "bytes:", err)
+		return false
+	}
+	if(bytesWritten < fileInformation.DataLength){
+		fmt.Printf("[!] Run list only covers %d of %d bytes, the file is incomplete\n", bytesWritten, fileInformation.DataLength)
+	}
+	return true
+}
+
+// WOF compressed files (CompactOS, compact /exe) only have a sparse unnamed $DATA, the content is decompressed from the WofCompressedData stream
+func carveWofFile(deviceLocation string, volume internal.VOLUME_INFO, fileInformation internal.FILE_INFO, outputFile string) bool{
+	wofStream, ok := parser.SelectStream(fileInformation, "WofCompressedData")
+	if(!ok){
+		fmt.Println("[!] File is WOF compressed but has no WofCompressedData stream")
+		return false
+	}
+	compressedData := wofStream.ResidentData
+	if(!wofStream.IsResident || compressedData == nil){
+		var buffer bytes.Buffer
+		bytesRead, err := parser.ReadDataRuns(deviceLocation, wofStream.DataRuns, volume.NTFSOffset, volume.ClusterSize, wofStream.DataLength, &buffer)
+		if(err != nil || bytesRead < wofStream.DataLength){
+			fmt.Println("[!] Unable to read the WofCompressedData stream:", err)
+			return false
+		}
+		compressedData = buffer.Bytes()
+	}
+
+	fmt.Printf("[+] Decompressing %s (volume %d, RID %d), WOF %s, size: %d into file: %s\n", fileInformation.FileName, volume.VolumeID, fileInformation.RecordID, internal.WofAlgorithmToString(fileInformation.WofAlgorithm), fileInformation.DataLength, outputFile)
+	outputHandle, err := os.Create(outputFile)
+	if err != nil {
+		fmt.Println("[!] Unable to create output file:", err)
+		return false
+	}
+	defer outputHandle.Close()
+	bytesWritten, err := parser.DecompressWof(compressedData, fileInformation.DataLength, fileInformation.WofAlgorithm, outputHandle)
+	if err != nil {
+		fmt.Println("[!] Carving failed after", bytesWritten, "bytes:", err)
+		return false
+	}
+	return true
+}
+
+func carveFileFromDB(deviceLocation string, FID int, stream string, dbFile string, outputFile string) bool{
+	if(!db.OpenSQLiteDB(dbFile)){
+		return false
+	}
+	defer db.Database.Close()
+	volume, fileInformation, ok := db.LoadFileRecord(FID, stream)
+	if(!ok){
+		return false
+	}
+	// Content stored in the database is written as is, everything else is read from the disk or image
+	storedInDB := fileInformation.IsResident && fileInformation.ResidentData != nil
+	if(fileInformation.IsWofCompressed){
+		wofStream, ok := parser.SelectStream(fileInformation, "WofCompressedData")
+		storedInDB = ok && wofStream.IsResident && wofStream.ResidentData != nil
+	}
+	if(!storedInDB && (!hasDiskToCarveFrom(volume) || !canReadDisk(deviceLocation))){
+		return false
+	}
+	// Resident content above the -residentLimit isn't in the database, the record is read again so the fixups can be applied
+	if(fileInformation.IsResident && fileInformation.ResidentData == nil){
+		fmt.Println("[+] Resident data is not stored in the database, reading it from the MFT record")
+		return carveFileByRecordLive(deviceLocation, int64(volume.NTFSOffset), "", int64(fileInformation.RecordID), stream, outputFile)
+	}
+	// Same for a small WOF compressed file with a resident WofCompressedData stream
+	if(fileInformation.IsWofCompressed){
+		if wofStream, ok := parser.SelectStream(fileInformation, "WofCompressedData"); ok && wofStream.IsResident && wofStream.ResidentData == nil{
+			fmt.Println("[+] Resident WofCompressedData is not stored in the database, reading it from the MFT record")
+			return carveFileByRecordLive(deviceLocation, int64(volume.NTFSOffset), "", int64(fileInformation.RecordID), stream, outputFile)
+		}
+	}
+	return carveFile(deviceLocation, volume, fileInformation, outputFile)
+}
+
+// Resolves -path or -rid to a single file ID, if the same file exists on several volumes -volume has to pick one.
+// A path can end in :streamname to select an alternate data stream, which is returned as well.
+func findFileIDInDB(path string, RID int, volumeSelector string, dbFile string) (int, string, bool){
+	if(!db.OpenSQLiteDB(dbFile)){
+		return 0, "", false
+	}
+	defer db.Database.Close()
+	volumeID, ok := resolveVolumeSelector(db.Database, volumeSelector)
+	if(!ok){
+		return 0, "", false
+	}
+	stream := ""
+	if(path != ""){
+		path, stream = splitStreamName(path)
+		_, path, ok = normalizeLookupPath(path)
+		if(!ok){
+			return 0, "", false
+		}
+	}
+	FIDs := db.FindFileIDs(path, RID, volumeID)
+	for hops := 0; len(FIDs) == 0 && path != "" && hops < maxLinkHops; hops++{
+		if path, ok = resolveLinkedPath(db.Database, volumeID, path); !ok{
+			break
+		}
+		FIDs = db.FindFileIDs(path, RID, volumeID)
+	}
+	if(len(FIDs) == 0){
+		fmt.Println("[!] No matching entry found in", dbFile)
+		return 0, "", false
+	}
+	if(len(FIDs) > 1){
+		fmt.Println("[!] Multiple volumes contain this file, use -volume to select one")
+		return 0, "", false
+	}
+	return FIDs[0], stream, true
+}
+
+// Splits file.txt:payload into the path and the stream name, the colon of a drive letter (C:\) is left alone
+func splitStreamName(path string) (string, string){
+	lastSep := strings.LastIndex(path, `\`)
+	colonIdx := strings.LastIndex(path, ":")
+	if(colonIdx <= lastSep){
+		return path, ""
+	}
+	return path[:colonIdx], path[colonIdx+1:]
+}
+
+// Without a database the record is read straight from the $MFT, its record number gives the position within the $MFT runs
+func carveFileByRecordLive(deviceLocation string, partitionOffset int64, volumeSelector string, RID int64, stream string, outputFile string) bool{
 	const NTFSBootSectorSize = 512
 	const recordSize = 1024
-	totalRecords := 0
+	volumeCounter := 0
+	for _, volume := range listVolumeCandidates(deviceLocation, partitionOffset){
+		ntfsHeader := parser.ParseNTFSHeader(deviceLocation, volume.NTFSOffset, NTFSBootSectorSize)
+		if(!parser.IsNTFSBootSector(ntfsHeader)){
+			continue
+		}
+		volumeCounter++
+		volume.VolumeID = volumeCounter
+		volume.ClusterSize = uint32(ntfsHeader.BytesPerSector)*uint32(ntfsHeader.SectorPerCluster)
+		volume.VolumeSerialNumber = ntfsHeader.VolumeSerialNumber
+		serialNumber := fmt.Sprintf("%016X", volume.VolumeSerialNumber)
+		if(volumeSelector != "" && volumeSelector != fmt.Sprint(volume.VolumeID) && !strings.EqualFold(volumeSelector, serialNumber) && !strings.EqualFold(volumeSelector, volume.PartitionGUID)){
+			continue
+		}
+
+		fmt.Printf("[+] Reading record %d from the $MFT of volume %d (serial number: %s)\n", RID, volume.VolumeID, serialNumber)
+		MFTOffset := volume.NTFSOffset + ntfsHeader.MFTOffset*uint64(volume.ClusterSize)
+		volume.MFTBlocks, _ = parser.GetMFTOffsetLocationsFromMFT(deviceLocation, volume, MFTOffset, recordSize)
+		recordBuffer, recordOffset, ok := parser.ReadMFTRecord(deviceLocation, volume.MFTBlocks, volume.NTFSOffset, volume.ClusterSize, recordSize, RID)
+		if(!ok || string(recordBuffer[0:4]) != "FILE"){
+			fmt.Println("[!] Record", RID, "is not an in use record slot of the $MFT")
+			return false
+		}
+		fileInformation := parser.ParseMFTRecord(recordBuffer, recordOffset, volume.NTFSOffset, volume.ClusterSize, 0)
+		fileInformation.RecordID = uint32(RID)
+		if(fileInformation.IsCorrupt){
+			fmt.Println("[!] Record", RID, "is corrupt (fixup mismatch)")
+			return false
+		}
+		if(fileInformation.BaseRecord != 0 || fileInformation.BaseSequence != 0){
+			fmt.Printf("[!] Record %d is an extension record of record %d, carve that one instead\n", RID, fileInformation.BaseRecord)
+			return false
+		}
+		parser.ResolveAttributeList(deviceLocation, volume, recordSize, &fileInformation)
+		if(stream != ""){
+			if fileInformation, ok = parser.SelectStream(fileInformation, stream); !ok {
+				fmt.Println("[!] Record", RID, "has no stream named", stream)
+				return false
+			}
+		}
+		return carveFile(deviceLocation, volume, fileInformation, outputFile)
+	}
+	fmt.Println("[!] No matching NTFS volume found")
+	return false
+}
+
+/* MFT to DB or File functionality */
+const logicalBlockAddressSize = 512
+
+func listGPTPartitions(deviceLocation string) []internal.VOLUME_INFO{
+	const GPTLBA = 1									//we need the first LBA, LBA0 is legacy	
 	
 	fmt.Println("[+] Parsing GPT Header")
 	gptheader := parser.ParseGPTHeader(deviceLocation, logicalBlockAddressSize, GPTLBA)				
@@ -99,39 +399,333 @@ func dumpMFT(deviceLocation string, dumpMode int){
 	fmt.Printf("\n  --> With %d partitions, of size: %d, we need a buffer of: %d", gptheader.NumberOfPartitions, gptheader.PartitionEntrySize, gptheader.NumberOfPartitions * gptheader.PartitionEntrySize)
 	fmt.Println("\n[+] Parsing Partition table")
 	numberOfPartitions, partitions := parser.ParsePartitions(deviceLocation, partitionTableOffset, gptheader.PartitionEntrySize, gptheader.NumberOfPartitions)
-	fmt.Printf("  --> Number of partitions identified: %d",numberOfPartitions)
-	fmt.Println("\n[+] Determining windows Base partition / NTFS partition")
-	basicPartitionFound, partNumber := identifyBasicPartition(partitions, NTFSSearchGUID)
-	if(basicPartitionFound){
-		NTFSOffset := logicalBlockAddressSize * partitions[partNumber].StartingLBA
-		fmt.Printf("  --> Found basic partition starting at offset: %d",NTFSOffset)
-		fmt.Println("\n[+] Parsing NTFS header")
-		ntfsHeader := parser.ParseNTFSHeader(deviceLocation,NTFSOffset, NTFSBootSectorSize)
-		if(ntfsHeader.OemID == NTFSOEMIndicator){
-			fmt.Println("  --> Validated basic partition to be NTFS by comparing oemID")
-			fmt.Printf("  --> Using BytesPerSector: %d, SectorsPerCluster: %d\n",ntfsHeader.BytesPerSector, ntfsHeader.SectorPerCluster)
-			clusterSize := uint32(ntfsHeader.BytesPerSector)*uint32(ntfsHeader.SectorPerCluster)
-			MFTOffset := NTFSOffset + ntfsHeader.MFTOffset*clusterSize
-			fmt.Printf("  --> Master File Table ($MFT) offset found at: %d, e.g. a total offset of: %d", ntfsHeader.MFTOffset, MFTOffset)
-			fmt.Printf("\n  --> $MFT offset - NFTSoffset (as used in the table): %d or %x in hex", MFTOffset - NTFSOffset,MFTOffset - NTFSOffset)
-			fmt.Println("\n[+] Parsing Master File Table (this can take a while)")
-			MFTBlockArray := parser.GetMFTOffsetLocationsFromMFT(deviceLocation, MFTOffset, recordSize, NTFSOffset)
-			fmt.Printf("  --> Found %d MFT Blocks\n\n", len(MFTBlockArray))
-			// The first MFT Block, contains the $MFT file as well. The first 26 files (include the $MFT file, $MFT mirror, etc.) also have some slack ones. Hence we skip parsing them for the sake of simplicity
-			totalRecords = iterateMFT(deviceLocation, uint64(MFTBlockArray[0]), recordSize, 26, NTFSOffset, clusterSize, dumpMode)
-			for blockIndex := 1; blockIndex < len(MFTBlockArray); blockIndex++ {
-				totalRecords = totalRecords + iterateMFT(deviceLocation, uint64(MFTBlockArray[blockIndex]), recordSize, 0, NTFSOffset, clusterSize, dumpMode)
+	fmt.Printf("  --> Number of partitions identified: %d\n",numberOfPartitions)
+	return listGPTPartitionCandidates(partitions)
+}
+
+func listMBRPartitions(deviceLocation string) []internal.VOLUME_INFO{
+	fmt.Println("[+] Parsing MBR Partition table (including logical partitions)")
+	numberOfPartitions, partitions := parser.ParseMBRPartitions(deviceLocation, logicalBlockAddressSize)
+	fmt.Printf("  --> Number of partitions identified: %d\n",numberOfPartitions)
+	return listMBRPartitionCandidates(partitions)
+}
+
+func dumpNTFSVolume(deviceLocation string, volume internal.VOLUME_INFO, dumpMode int) bool{
+	const NTFSBootSectorSize = 512
+	const recordSize = 1024
+	totalRecords := 0
+	
+	fmt.Printf("\n[+] Parsing NTFS header of partition %d (type: %s) starting at offset: %d\n", volume.PartitionIndex, volume.PartitionType, volume.NTFSOffset)
+	ntfsHeader := parser.ParseNTFSHeader(deviceLocation, volume.NTFSOffset, NTFSBootSectorSize)
+	if(!parser.IsNTFSBootSector(ntfsHeader)){
+		fmt.Println("  --> Not an NTFS partition, skipping")
+		return false
+	}
+	fmt.Println("  --> Validated partition to be NTFS by comparing oemID")
+	fmt.Printf("  --> Using BytesPerSector: %d, SectorsPerCluster: %d\n",ntfsHeader.BytesPerSector, ntfsHeader.SectorPerCluster)
+	volume.ClusterSize = uint32(ntfsHeader.BytesPerSector)*uint32(ntfsHeader.SectorPerCluster)
+	volume.VolumeSerialNumber = ntfsHeader.VolumeSerialNumber
+	fmt.Printf("  --> Volume %d, serial number: %016X, partition GUID: %s\n", volume.VolumeID, volume.VolumeSerialNumber, volume.PartitionGUID)
+	if(dumpMode == 2){
+		db.InsertVolume(volume)
+	}
+	MFTOffset := volume.NTFSOffset + ntfsHeader.MFTOffset*uint64(volume.ClusterSize)
+	fmt.Printf("  --> Master File Table ($MFT) offset found at: %d, e.g. a total offset of: %d", ntfsHeader.MFTOffset, MFTOffset)
+	fmt.Printf("\n  --> $MFT offset - NFTSoffset (as used in the table): %d or %x in hex", MFTOffset - volume.NTFSOffset,MFTOffset - volume.NTFSOffset)
+	fmt.Println("\n[+] Parsing Master File Table (this can take a while)")
+	MFTBlockArray, MFTRealSize := parser.GetMFTOffsetLocationsFromMFT(deviceLocation, volume, MFTOffset, recordSize)
+	volume.MFTBlocks = MFTBlockArray
+	totalSlots := int64(MFTRealSize) / recordSize
+	fmt.Printf("  --> Found %d MFT Blocks, holding %d record slots\n", len(MFTBlockArray), totalSlots)
+	// Files only carry a security ID, the descriptors themselves are shared through $Secure:$SDS
+	securityDescriptors, err := parser.LoadSecurityDescriptors(deviceLocation, volume, recordSize)
+	if(err != nil){
+		fmt.Println("  --> Unable to load the security descriptors from $Secure:$SDS:", err)
+	} else{
+		fmt.Printf("  --> Loaded %d security descriptors from $Secure:$SDS\n", len(securityDescriptors))
+	}
+	volume.SecurityDescriptors = securityDescriptors
+	if(dumpMode == 2){
+		db.InsertSecurityDescriptors(volume, securityDescriptors)
+	}
+	fmt.Println()
+	// The data runs determine how many records each block holds, the real size of $MFT caps the total (the last run can be over allocated)
+	recordNumber := int64(0)
+	skippedRecords := 0
+	for _, MFTBlock := range MFTBlockArray {
+		recordsInBlock := MFTBlock.ClusterCount * int64(volume.ClusterSize) / recordSize
+		if(recordNumber + recordsInBlock > totalSlots){
+			recordsInBlock = totalSlots - recordNumber
+		}
+		if(recordsInBlock <= 0){
+			break
+		}
+		parsed, skipped := iterateMFT(deviceLocation, MFTBlock, recordNumber, recordsInBlock, recordSize, volume, dumpMode)
+		totalRecords = totalRecords + parsed
+		skippedRecords = skippedRecords + skipped
+		recordNumber = recordNumber + recordsInBlock
+	}
+	// Flush DB insert, just in case any records are still left in memory
+	db.FlushBatch()
+	if(dumpMode == 2){
+		checkDeletedFileClusters(deviceLocation, volume)
+	}
+	
+	fmt.Printf("\n  --> Found %d files in the $MFT records of volume %d\n", totalRecords, volume.VolumeID)
+	fmt.Printf("  --> Skipped %d empty, non-FILE or extension record slots\n", skippedRecords)
+	return true
+}
+
+// Lists the candidate volumes of the input, either the single volume at partitionOffset or every partition from the MBR/GPT
+func listVolumeCandidates(deviceLocation string, partitionOffset int64) []internal.VOLUME_INFO{
+	// A single volume image (e.g. a \\.\C: acquisition or ntfsclone output) has no partition table at all.
+	// Note that an NTFS boot sector also ends with 0x55AA, so it has to be ruled out before treating LBA0 as an MBR.
+	if(partitionOffset < 0 && parser.IsNTFSVolume(deviceLocation, 0)){
+		fmt.Println("[+] NTFS boot sector found at offset 0, treating input as a single volume image")
+		partitionOffset = 0
+	}
+	if(partitionOffset >= 0){
+		var volume internal.VOLUME_INFO
+		volume.PartitionType = "volume"
+		volume.NTFSOffset = uint64(partitionOffset)
+		return []internal.VOLUME_INFO{volume}
+	}
+
+	// LBA0 always holds an MBR, on GPT disks this is a protective MBR with a single 0xEE partition
+	fmt.Println("[+] Parsing Master Boot Record")
+	mbrHeader := parser.ParseMBR(deviceLocation, logicalBlockAddressSize)
+	if(!parser.IsValidMBR(mbrHeader)){
+		fmt.Println("  --> No valid MBR boot signature found, unable to determine partition layout")
+		return nil
+	}
+
+	if(parser.IsProtectiveMBR(mbrHeader)){
+		fmt.Println("  --> Protective MBR found, disk is GPT partitioned")
+		return listGPTPartitions(deviceLocation)
+	}
+	fmt.Println("  --> Legacy MBR partitioned disk")
+	return listMBRPartitions(deviceLocation)
+}
+
+// $Bitmap (record 6) tells which clusters are in use, deleted files whose clusters are still free can be recovered intact
+func checkDeletedFileClusters(deviceLocation string, volume internal.VOLUME_INFO){
+	const bitmapRecord = 6
+	bitmapRuns, ok := db.LoadDataRuns(volume, bitmapRecord, "")
+	if(!ok || len(bitmapRuns) == 0){
+		fmt.Println("  --> [!] No $Bitmap found, unable to check the clusters of deleted files")
+		return
+	}
+	lastRun := bitmapRuns[len(bitmapRuns)-1]
+	bitmapSize := uint64(lastRun.VCN + lastRun.ClusterCount) * uint64(volume.ClusterSize)
+	var clusterBitmap bytes.Buffer
+	if _, err := parser.ReadDataRuns(deviceLocation, bitmapRuns, volume.NTFSOffset, volume.ClusterSize, bitmapSize, &clusterBitmap); err != nil {
+		fmt.Println("  --> [!] Unable to read $Bitmap:", err)
+		return
+	}
+	db.UpdateClusterStatus(volume.VolumeID, clusterBitmap.Bytes())
+}
+
+func dumpMFT(deviceLocation string, partitionOffset int64, dumpMode int){
+	candidates := listVolumeCandidates(deviceLocation, partitionOffset)
+	if(candidates == nil){
+		return
+	}
+
+	// Volume IDs are only handed out to partitions that turn out to be NTFS
+	volumeCounter := 0
+	for _, volume := range candidates{
+		volume.VolumeID = volumeCounter + 1
+		if(dumpNTFSVolume(deviceLocation, volume, dumpMode)){
+			volumeCounter++
+		}
+	}
+	fmt.Printf("\n  --> Processed %d NTFS volume(s)\n", volumeCounter)
+}
+
+// Extracted $MFT files (KAPE, Velociraptor, FTK, ...) are just all records back to back
+func dumpMFTFile(mftFile string, dumpMode int){
+	const recordSize = 1024
+	var volume internal.VOLUME_INFO
+	volume.VolumeID = 1
+	volume.PartitionType = "$MFT file"
+	volume.StandaloneMFT = true
+
+	handle, err := os.Open(mftFile)
+	if err != nil {
+		fmt.Println("[!] Unable to open $MFT file:", err)
+		return
+	}
+	defer handle.Close()
+
+	fmt.Println("[+] Parsing standalone $MFT file:", mftFile)
+	fmt.Println("  --> No disk available, data locations are stored as cluster numbers only")
+	fmt.Println("  --> Security IDs are stored, but $Secure:$SDS can't be read to resolve them")
+	if(dumpMode == 2){
+		db.InsertVolume(volume)
+	}
+	// The whole file is one block, so extension records can be looked up by their position
+	if fileStat, err := handle.Stat(); err == nil {
+		volume.MFTBlocks = []internal.DATA_RUN{{ClusterCount: fileStat.Size() / recordSize}}
+	}
+	totalRecords := 0
+	skippedRecords := 0
+	mftRecordBuffer := make([]byte, recordSize)
+	for recordNumber := int64(0); ; recordNumber++ {
+		bytesRead, _ := io.ReadFull(handle, mftRecordBuffer)
+		if bytesRead < recordSize {
+			break
+		}
+		if(processRecordSlot(mftFile, mftRecordBuffer, recordNumber, recordNumber*recordSize, volume, dumpMode)){
+			totalRecords++
+		} else{
+			skippedRecords++
+		}
+	}
+	db.FlushBatch()
+	fmt.Printf("\n  --> Found %d files in the $MFT file\n", totalRecords)
+	fmt.Printf("  --> Skipped %d empty, non-FILE or extension record slots\n", skippedRecords)
+}
+
+// A volume can be selected by its volume ID, NTFS serial number or (GPT) unique partition GUID
+func resolveVolumeSelector(database *sql.DB, volumeSelector string) (int, bool){
+	if(volumeSelector == ""){
+		return 0, true
+	}
+	query := "SELECT volumeID FROM volumes WHERE CAST(volumeID AS TEXT) = ? OR volumeSerialNumber = ? COLLATE NOCASE OR partitionGUID = ? COLLATE NOCASE"
+	var volumeID int
+	err := database.QueryRow(query, volumeSelector, volumeSelector, volumeSelector).Scan(&volumeID)
+	if err != nil {
+		fmt.Println("[!] Unknown volume:", volumeSelector)
+		return 0, false
+	}
+	return volumeID, true
+}
+
+// Splits a user supplied path into the file name and the full path as stored in the database
+func normalizeLookupPath(userInput string) (string, string, bool){
+	// Fix user input (remove Drive letter,. remove escaping, isn't needed, abort if no file is provided)
+	userInput = strings.ReplaceAll(userInput, "//./", "")
+	userInput = strings.ReplaceAll(userInput, "//", "/")
+
+	lastSep := strings.LastIndex(userInput, `\`)
+    if lastSep == -1 {
+        fmt.Println("[!] Invalid path format")
+        return "", "", false
+    }
+    file := userInput[lastSep+1:]
+    path := userInput
+
+    // Remove drive letter (e.g. "C:\"), user shouldn't input this, but regardless kill it, if its there
+    if colonIdx := strings.Index(path, `:\`); colonIdx != -1 {
+        path = path[colonIdx+2:]
+    }
+	return file, path, true
+}
+
+// Lists the alternate data streams of a file, each with the command to carve it
+func printStreams(database *sql.DB, volumeID int, RID int, path string, standalone bool){
+	rows, err := database.Query("SELECT name, streamLength, isResident, residentData IS NOT NULL FROM streams WHERE volumeID = ? AND RID = ?", volumeID, RID)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name string
+		var length int64
+		var resident int
+		var hasResidentData bool
+		if err := rows.Scan(&name, &length, &resident, &hasResidentData); err != nil {
+			return
+		}
+		fmt.Printf("Stream: %s (%d bytes, resident: %t)\n", name, length, resident == 1)
+		if standalone && !hasResidentData {
+			continue
+		}
+		fmt.Printf("Command: go run MFT2SQL.go -carve -path \"%s:%s\"\n", path, name)
+	}
+}
+
+// Shows where a symbolic link, junction or mount point leads, and what kind of placeholder a cloud file is
+func printReparsePoint(database *sql.DB, volumeID int, RID int){
+	var tagName, targetPath, printName string
+	var relative int
+	err := database.QueryRow("SELECT tagName, targetPath, printName, isRelative FROM reparse_points WHERE volumeID = ? AND RID = ?", volumeID, RID).Scan(&tagName, &targetPath, &printName, &relative)
+	if err != nil {
+		return
+	}
+	if targetPath == "" {
+		fmt.Println("Reparse point:", tagName)
+		return
+	}
+	if printName == "" {
+		printName = targetPath
+	}
+	if relative == 1 {
+		printName = printName + " (relative)"
+	}
+	fmt.Printf("Reparse point: %s -> %s\n", tagName, printName)
+}
+
+// Shows the owner and the permissions (SDDL) of a file, resolved through its security ID
+func printSecurityDescriptor(database *sql.DB, FID int){
+	var ownerSID, sddl string
+	err := database.QueryRow("SELECT s.ownerSID, s.sddl FROM files f JOIN security_descriptors s ON s.volumeID = f.volumeID AND s.securityID = f.securityID WHERE f.FID = ?", FID).Scan(&ownerSID, &sddl)
+	if err != nil {
+		return
+	}
+	fmt.Println("Owner:", internal.SIDToName(ownerSID))
+	fmt.Println("Security:", sddl)
+}
+
+// Replaces the first parent directory of a path that is a junction or symbolic link with its target.
+// Targets on another volume (volume mount points, UNC paths) can't be followed within the database.
+func resolveLinkedPath(database *sql.DB, volumeID int, path string) (string, bool){
+	components := strings.Split(path, `\`)
+	for i := 1; i < len(components); i++ {
+		linkPath := strings.Join(components[:i], `\`)
+		var tagName, targetPath string
+		var relative int
+		err := database.QueryRow(`SELECT r.tagName, r.targetPath, r.isRelative FROM reparse_points r JOIN files f ON f.volumeID = r.volumeID AND f.RID = r.RID
+			WHERE f.fullPath = ? COLLATE NOCASE AND (? = 0 OR r.volumeID = ?) AND r.tag IN (?, ?)`, linkPath, volumeID, volumeID, internal.ReparseTagMountPoint, internal.ReparseTagSymlink).Scan(&tagName, &targetPath, &relative)
+		if err != nil {
+			continue
+		}
+		// Substitute names are NT paths: \??\C:\Users
+		targetPath = strings.TrimPrefix(targetPath, `\??\`)
+		if relative == 1 {
+			targetPath = strings.Join(components[:i-1], `\`) + `\` + targetPath
+		} else if strings.Index(targetPath, `:\`) == 1 {
+			targetPath = targetPath[3:]
+		} else {
+			fmt.Printf("[!] %s is a %s to %s, which is not on this volume\n", linkPath, strings.ToLower(tagName), targetPath)
+			return "", false
+		}
+		resolvedPath := cleanLookupPath(targetPath + `\` + strings.Join(components[i:], `\`))
+		fmt.Printf("[+] %s is a %s, following it to: %s\n", linkPath, strings.ToLower(tagName), resolvedPath)
+		return resolvedPath, true
+	}
+	return "", false
+}
+
+// Drops empty and . components and applies .. components, as relative link targets produce them
+func cleanLookupPath(path string) string{
+	var components []string
+	for _, component := range strings.Split(path, `\`) {
+		switch component {
+		case "", ".":
+		case "..":
+			if len(components) > 0 {
+				components = components[:len(components)-1]
 			}
-			// Flush DB insert, just in case any records are still left in memory
-			db.FlushBatch()
-			
-			fmt.Printf("\n  --> Found %d files in the $MFT records",totalRecords)
+		default:
+			components = append(components, component)
 		}
 	}
+	return strings.Join(components, `\`)
 }
 
 // search sql database, for the file, and print info
-func searchFileAndPrintInfo(userInput string, dbFile string) bool{
+func searchFileAndPrintInfo(userInput string, volumeSelector string, dbFile string) bool{
 	// Set-up our DB connection
     var err error
 	var database *sql.DB
@@ -140,94 +734,248 @@ func searchFileAndPrintInfo(userInput string, dbFile string) bool{
         fmt.Println("[!] Error opening database:", err)
         return false
     }
+    defer database.Close()
 
     // Ensure the DB connection is alive
     if err = database.Ping(); err != nil {
         fmt.Println("[!] Failed to connect to database:", err)
         return false
     }
-	
-	// Fix user input (remove Drive letter,. remove escaping, isn't needed, abort if no file is provided)
-	userInput = strings.ReplaceAll(userInput, "//./", "")
-	userInput = strings.ReplaceAll(userInput, "//", "/")
 
-	lastSep := strings.LastIndex(userInput, `\`)
-    if lastSep == -1 {
-        fmt.Println("[!] Invalid path format")
+    volumeID, ok := resolveVolumeSelector(database, volumeSelector)
+    if !ok {
         return false
     }
-    file := userInput[lastSep+1:]
-    path := userInput
-
-    // Remove drive letter (e.g. "C:\"), user shouldn't input this, but regardless kill it, if its there
-    if colonIdx := strings.Index(path, `:\`); colonIdx != -1 {
-        path = path[colonIdx+2:]
-    }
 	
-	query := "SELECT RID, fileOffset, fileLength, isActive FROM files WHERE filename = ? AND fullPath = ? COLLATE NOCASE"
-
-    row := database.QueryRow(query, file, path)
-    var rid, offset, length, active int
-    err = row.Scan(&rid, &offset, &length, &active)
-    if err != nil {
-        fmt.Println("[!] No matching entry found:", err)
+	file, path, ok := normalizeLookupPath(userInput)
+	if !ok {
+		return false
+	}
+	
+	// A path through a junction or symbolic link (Documents and Settings, a linked profile folder) isn't in the database as such, the link is followed instead
+	matches, ok := printFileMatches(database, file, path, volumeID)
+	for hops := 0; ok && matches == 0 && hops < maxLinkHops; hops++ {
+		if path, ok = resolveLinkedPath(database, volumeID, path); ok {
+			matches, ok = printFileMatches(database, file, path, volumeID)
+		}
+	}
+    if matches == 0 {
+        fmt.Println("[!] No matching entry found")
         return false
     }
-
-    fmt.Println("📄 File:", file)
-    fmt.Println("Offset:", offset)
-    fmt.Println("Length:", length)
-	fmt.Println("Command: go run MFT2SQL.go -carve -fileOffset ", offset, " -fileLength ", length)
+    if matches > 1 && volumeID == 0 {
+        fmt.Println("[+] Multiple volumes contain this path, use -volume to select one")
+    }
 
 	return true
 }
 
+// Links can point to other links, but not forever
+const maxLinkHops = 8
 
+// Prints every file stored under the path, returns how many there were
+func printFileMatches(database *sql.DB, file string, path string, volumeID int) (int, bool){
+	// The same path can exist on multiple volumes (e.g. a second Windows install), without a volume selector all of them are shown
+	// Hard links and DOS short paths are matched through the names table
+	query := "SELECT FID, volumeID, RID, fileOffset, fileCluster, fileLength, isActive, residentData IS NOT NULL FROM files WHERE (fullPath = ? COLLATE NOCASE OR (volumeID, RID) IN (SELECT volumeID, RID FROM names WHERE fullPath = ? COLLATE NOCASE)) AND (? = 0 OR volumeID = ?)"
 
+    rows, err := database.Query(query, path, path, volumeID, volumeID)
+    if err != nil {
+        fmt.Println("[!] Query failed:", err)
+        return 0, false
+    }
+    defer rows.Close()
 
+    matches := 0
+    for rows.Next() {
+        var fid, volume, rid, length, active int
+        var offset, cluster sql.NullInt64
+        var hasResidentData bool
+        if err = rows.Scan(&fid, &volume, &rid, &offset, &cluster, &length, &active, &hasResidentData); err != nil {
+            fmt.Println("[!] Failed to read entry:", err)
+            return matches, false
+        }
+        matches++
+        fmt.Println("📄 File:", file)
+        fmt.Println("Volume:", volume)
+        if cluster.Valid {
+            fmt.Println("Cluster:", cluster.Int64)
+        }
+        fmt.Println("Length:", length)
+        printReparsePoint(database, volume, rid)
+        printSecurityDescriptor(database, fid)
+        // Databases built from a standalone $MFT file have no absolute offsets, only the resident data stored with the record can be carved
+        standalone := !offset.Valid
+        if standalone {
+            fmt.Println("Offset: unknown (database was built from a standalone $MFT file)")
+        } else {
+            fmt.Println("Offset:", offset.Int64)
+        }
+        if !standalone || hasResidentData {
+            fmt.Println("Command: go run MFT2SQL.go -carve -fid", fid)
+        }
+        printStreams(database, volume, rid, path, standalone)
+    }
+	return matches, true
+}
+
+// Make sure the physical disk or image file can actually be read before doing any work
+func validateInput(deviceLocation string) bool{
+	handle, err := os.Open(deviceLocation)
+	if err != nil {
+		fmt.Println("[!] Unable to open input:", err)
+		return false
+	}
+	handle.Close()
+	return true
+}
 
+// Command line options, collected in main and handed to the mode dispatcher
+type runOptions struct {
+    help            bool
+    deviceLocation  string
+    mftFile         string
+    partitionOffset int64
+    dumpMode        int
+    carve           bool
+    fileOffset      int
+    fileLength      int
+    fid             int
+    path            string
+    rid             int64
+    getFileLocation string
+    findings        bool
+    downloads       bool
+    writable        bool
+    residentLimit   int
+    deletedFiles    bool
+    volumeSelector  string
+    dbFile          string
+    dumpFile        string
+}
 
+// Opens the database, resolves the -volume selector and prints one of the db.Print* listings for that volume
+func printListingFromDB(dbFile string, volumeSelector string, printListing func(int) bool) bool {
+    if !db.OpenSQLiteDB(dbFile) {
+        return false
+    }
+    defer db.Database.Close()
+    volumeID, ok := resolveVolumeSelector(db.Database, volumeSelector)
+    return ok && printListing(volumeID)
+}
 
-func runModeDispatcher(help bool, carve bool, getFileLocation string, dumpMode int, deviceLocation string, fileOffset int, fileLength int, dumpFile string, dbFile string) {
+func runModeDispatcher(options runOptions) {
     // Default behavior: show help banner
-    if help || (!carve && getFileLocation == "" && dumpMode == 0) {
+    if options.help || (!options.carve && !options.findings && !options.downloads && !options.writable && !options.deletedFiles && options.getFileLocation == "" && options.dumpMode == 0) {
         intro.ShowBannerAndIntro()
         flag.Usage()
         os.Exit(0)
     }
 
-    if carve {
-        if fileOffset == 0 || fileLength == 0 {
-            fmt.Println("[!] Please provide both fileOffset and fileLength when using --carve.")
+    // Only the modes touching the disk or image need it to be readable, a standalone $MFT file replaces the disk when dumping.
+    // Carving a record from the database checks the disk once it is known the data isn't stored in the database itself.
+    _, dbErr := os.Stat(options.dbFile)
+    carveFromDB := options.carve && (options.fid != 0 || ((options.path != "" || options.rid >= 0) && dbErr == nil))
+    if (options.carve && !carveFromDB) || options.dumpMode != 0 {
+        inputLocation := options.deviceLocation
+        if options.mftFile != "" && !options.carve {
+            inputLocation = options.mftFile
+        }
+        if !canReadDisk(inputLocation) {
+            os.Exit(1)
+        }
+    }
+
+    // Files can be carved by -fid, -path or -rid in one step, -path and -rid are resolved through the database
+    if options.carve && (options.fid != 0 || options.path != "" || options.rid >= 0) {
+        fid := options.fid
+        stream := ""
+        if fid == 0 {
+            if dbErr == nil {
+                var ok bool
+                if fid, stream, ok = findFileIDInDB(options.path, int(options.rid), options.volumeSelector, options.dbFile); !ok {
+                    os.Exit(1)
+                }
+            } else if options.path != "" {
+                fmt.Println("[!] Database", options.dbFile, "not found, carving by -path requires a database (-dumpMode 2)")
+                os.Exit(1)
+            } else {
+                // Without a database the record is parsed live from the $MFT
+                fmt.Println("[+] Database", options.dbFile, "not found, parsing the MFT record live")
+                if !carveFileByRecordLive(options.deviceLocation, options.partitionOffset, options.volumeSelector, options.rid, "", options.dumpFile) {
+                    os.Exit(1)
+                }
+                return
+            }
+        }
+        fmt.Println("[+] Carving file from disk by following its data runs...")
+        if !carveFileFromDB(options.deviceLocation, fid, stream, options.dbFile, options.dumpFile) {
+            os.Exit(1)
+        }
+        return
+    }
+
+    if options.carve {
+        if options.fileOffset == 0 || options.fileLength == 0 {
+            fmt.Println("[!] Please provide -path, -rid, -fid, or both fileOffset and fileLength when using --carve.")
             return
         }
         fmt.Println("[+] Carving file from disk...")
-        dumpToFile(deviceLocation, fileOffset, fileLength, dumpFile)
+        dumpToFile(options.deviceLocation, options.fileOffset, options.fileLength, options.dumpFile)
         return
     }
 
-    if getFileLocation != "" {
-        fmt.Println("[+] Fetching file location info for:", getFileLocation)
-		if(!searchFileAndPrintInfo(getFileLocation, dbFile)){
+    // The listings only read the database
+    var printListing func(int) bool
+    switch {
+    case options.deletedFiles:
+        printListing = db.PrintDeletedFiles
+    case options.findings:
+        printListing = db.PrintFindings
+    case options.downloads:
+        printListing = db.PrintDownloads
+    case options.writable:
+        printListing = db.PrintWritableFiles
+    }
+    if printListing != nil {
+        if !printListingFromDB(options.dbFile, options.volumeSelector, printListing) {
+            os.Exit(1)
+        }
+        return
+    }
+
+    if options.getFileLocation != "" {
+        fmt.Println("[+] Fetching file location info for:", options.getFileLocation)
+		if(!searchFileAndPrintInfo(options.getFileLocation, options.volumeSelector, options.dbFile)){
 			os.Exit(1)
 		}
         return
     }
 
-    if dumpMode == 2 {
-        if !db.SetUpSQLiteDB(dbFile) {
+    if options.dumpMode == 2 {
+        if !db.SetUpSQLiteDB(options.dbFile) {
             fmt.Println("[+] Could not initialize the database. Exiting.")
             os.Exit(1)
         }
         db.InsertCounter = 0
-        dumpMFT(deviceLocation, dumpMode)
+        db.ResidentDataLimit = options.residentLimit
+        if options.mftFile != "" {
+            dumpMFTFile(options.mftFile, options.dumpMode)
+        } else {
+            dumpMFT(options.deviceLocation, options.partitionOffset, options.dumpMode)
+        }
         db.UpdateFullpaths()
+        db.DetectTimestomping()
         return
     }
 
-    if dumpMode == 1 {
+    if options.dumpMode == 1 {
         fmt.Println("[+️] Dumping MFT entries to screen...")
-        dumpMFT(deviceLocation, dumpMode)
+        if options.mftFile != "" {
+            dumpMFTFile(options.mftFile, options.dumpMode)
+        } else {
+            dumpMFT(options.deviceLocation, options.partitionOffset, options.dumpMode)
+        }
         return
     }
 
@@ -235,34 +983,55 @@ func runModeDispatcher(help bool, carve bool, getFileLocation string, dumpMode i
 }
 
 func main() {
-    var help = flag.Bool("help", false, "Show help banner and usage.")
-    var deviceLocation = "\\\\.\\physicaldrive0"
-    var dumpMode int
-    var carve = false
-    var fileOffset int
-    var fileLength int
-    var getFileLocation = ""
-    var dbFile = "MFTDB.db"
-    var dumpFile = "output.dump"
-
-    flag.StringVar(&deviceLocation, "deviceLocation", deviceLocation, "Specify the physical disk to dump")
-    flag.IntVar(&dumpMode, "dumpMode", 0, "Select MFT dump output: 1=screen, 2=SQL")
-    flag.StringVar(&dbFile, "dbFile", dbFile, "Specify the name of the SQLite database")
-    flag.StringVar(&dumpFile, "dumpFile", dumpFile, "Output file name for carving")
-    flag.StringVar(&getFileLocation, "getFileLocation", getFileLocation, "Lookup file location using its full path")
-	flag.BoolVar(&carve, "carve", carve, "Carve a file from disk, make sure -fileOffset and -fileLength are provided")
-    flag.IntVar(&fileOffset, "fileOffset", fileOffset, "Offset to start carving file from physical disk")
-    flag.IntVar(&fileLength, "fileLength", fileLength, "Length of file to carve")
+    var options runOptions
+    var imageFile = ""
+    options.deviceLocation = "\\\\.\\physicaldrive0"
+    options.partitionOffset = -1
+    options.rid = -1
+    options.dbFile = "MFTDB.db"
+    options.dumpFile = "output.dump"
+    options.residentLimit = db.ResidentDataLimit
+
+    flag.BoolVar(&options.help, "help", false, "Show help banner and usage.")
+    flag.StringVar(&options.deviceLocation, "deviceLocation", options.deviceLocation, "Specify the physical disk to dump")
+    flag.StringVar(&imageFile, "imageFile", imageFile, "Analyse a raw disk image (.dd/.raw/.img) instead of a physical disk")
+    flag.StringVar(&options.mftFile, "mftFile", options.mftFile, "Parse a standalone extracted $MFT file instead of a disk or image")
+    flag.Int64Var(&options.partitionOffset, "partitionOffset", options.partitionOffset, "Byte offset of the NTFS volume, skips GPT/MBR discovery (-1 = auto detect)")
+    flag.IntVar(&options.dumpMode, "dumpMode", 0, "Select MFT dump output: 1=screen, 2=SQL")
+    flag.StringVar(&options.dbFile, "dbFile", options.dbFile, "Specify the name of the SQLite database")
+    flag.StringVar(&options.dumpFile, "dumpFile", options.dumpFile, "Output file name for carving")
+    flag.IntVar(&options.residentLimit, "residentLimit", options.residentLimit, "Store resident file content up to this many bytes in the database (0 = disabled)")
+    flag.StringVar(&options.getFileLocation, "getFileLocation", options.getFileLocation, "Lookup file location using its full path")
+    flag.BoolVar(&options.findings, "findings", options.findings, "List the timestomping findings stored in the database")
+    flag.BoolVar(&options.downloads, "downloads", options.downloads, "List the downloaded files (Mark of the Web) stored in the database")
+    flag.BoolVar(&options.writable, "writable", options.writable, "List the files and folders that Everyone, Authenticated Users or Users can write to")
+    flag.BoolVar(&options.deletedFiles, "deletedFiles", options.deletedFiles, "List the deleted files in the database and whether their clusters are still unallocated")
+    flag.StringVar(&options.volumeSelector, "volume", options.volumeSelector, "Restrict -getFileLocation, -findings, -downloads, -writable, -deletedFiles and -carve to a volume (volume ID, serial number or partition GUID)")
+	flag.BoolVar(&options.carve, "carve", options.carve, "Carve a file from disk, make sure -path, -rid, -fid or -fileOffset and -fileLength are provided")
+    flag.IntVar(&options.fileOffset, "fileOffset", options.fileOffset, "Offset to start carving file from physical disk")
+    flag.IntVar(&options.fileLength, "fileLength", options.fileLength, "Length of file to carve")
+    flag.StringVar(&options.path, "path", options.path, "Full path of the file to carve (e.g. Windows\\System32\\config\\SAM), append :streamname for an alternate data stream")
+    flag.Int64Var(&options.rid, "rid", options.rid, "MFT record number of the file to carve, read from the database if present, otherwise parsed live from the $MFT")
+    flag.IntVar(&options.fid, "fid", options.fid, "File ID (FID) from the database of the file to carve, follows its data runs")
 
     flag.Parse()
 
-	// Application requires administrator privileges
-	if(!internal.IsAdmin()){
-		fmt.Println("[!] This tool must be run with administrative privileges.")
-        os.Exit(1)
-	} else{
-		runModeDispatcher(*help, carve, getFileLocation, dumpMode, deviceLocation, fileOffset, fileLength, dumpFile, dbFile)
+	// A raw image is just a regular file, it replaces the physical disk as input.
+	// Both name the input, when both are given it is unclear which one was meant.
+	if(imageFile != ""){
+		deviceLocationSet := false
+		flag.Visit(func(f *flag.Flag){
+			if(f.Name == "deviceLocation"){
+				deviceLocationSet = true
+			}
+		})
+		if(deviceLocationSet){
+			fmt.Println("[!] -imageFile and -deviceLocation both specify the input, use only one of them")
+			os.Exit(1)
+		}
+		options.deviceLocation = imageFile
 	}
-}
 
+	runModeDispatcher(options)
+}
 
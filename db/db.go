@@ -2,6 +2,9 @@ package db
 
 import "fmt"
 import "database/sql"
+import "sort"
+import "strconv"
+import "MFS2SQL/internal"
 import _ "modernc.org/sqlite"			
 
  
@@ -10,19 +13,28 @@ var Database *sql.DB
 // Structure to support sql batch insert, to increase application performance
 var (
     Tx        *sql.Tx
-    Stmt      *sql.Stmt
+    Stmts     = make(map[string]*sql.Stmt)     // Prepared statements of the current batch, keyed by query
     BatchSize = 10000
     Batch     = 0
     InsertCounter = 0
 )
 
+// Resident $DATA content up to this size is stored in the database (residentData), 0 disables it
+var ResidentDataLimit = 1024
+
 // Structure to support reconstructing full paths
 type sqlDBFileEntry struct {
     FID       int
+    VolumeID  int
     RID       int
+    Sequence  int
     ParentID  int
+    ParentSequence int
+    IsActive  bool
     Filename  string
     FullPath  string
+    IsOrphan  bool      // The parent chain doesn't lead back to the root (parent missing or its record slot was reused)
+    visiting  bool      // Guards against parent loops between stale records
 }
 
 /* Database functionality */
@@ -41,111 +53,642 @@ func SetUpSQLiteDB(dbFile string) bool {
         return false
     }
 
-    // Clear previous data by dropping the table, if it exists
-    _, err = Database.Exec(`DROP TABLE IF EXISTS files`)
-    if err != nil {
-        fmt.Println("[!] Error dropping table:", err)
-        return false
+    // Clear previous data by dropping the tables, if they exist
+    for _, table := range []string{"files", "volumes", "dataruns", "names", "streams", "mark_of_the_web", "reparse_points", "security_descriptors", "aces", "findings"} {
+        _, err = Database.Exec(`DROP TABLE IF EXISTS ` + table)
+        if err != nil {
+            fmt.Println("[!] Error dropping table:", err)
+            return false
+        }
     }
 
-    // Recreate the table
+    // Recreate the tables
     _, err = Database.Exec(`
         CREATE TABLE files (
-            FID INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT, RID INTEGER, parentID INTEGER, filename TEXT, fileOffset INTEGER, fileLength INTEGER, isFolder INTEGER, isActive INTEGER, fullPath TEXT
+            FID INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT, volumeID INTEGER, RID INTEGER, sequence INTEGER, parentID INTEGER, parentSequence INTEGER, filename TEXT, fileOffset INTEGER, fileCluster INTEGER, fileLength INTEGER, isResident INTEGER, residentData BLOB, isCompressed INTEGER, compressionUnit INTEGER, wofCompression TEXT, isFolder INTEGER, isActive INTEGER, isCorrupt INTEGER, securityID INTEGER, isOrphan INTEGER DEFAULT 0, clusterStatus TEXT, siCreated INTEGER, siModified INTEGER, siMFTModified INTEGER, siAccessed INTEGER, siCreatedUTC TEXT, siModifiedUTC TEXT, siMFTModifiedUTC TEXT, siAccessedUTC TEXT, fnCreated INTEGER, fnModified INTEGER, fnMFTModified INTEGER, fnAccessed INTEGER, fnCreatedUTC TEXT, fnModifiedUTC TEXT, fnMFTModifiedUTC TEXT, fnAccessedUTC TEXT, fullPath TEXT
         )
     `)
     if err != nil {
         fmt.Println("[!] Error creating table:", err)
         return false
     }
+
+    // Complete run list of every non-resident $DATA attribute, linked to the file record through volumeID and RID
+    _, err = Database.Exec(`
+        CREATE TABLE dataruns (
+            volumeID INTEGER, RID INTEGER, stream TEXT DEFAULT '', VCN INTEGER, LCN INTEGER, clusterCount INTEGER, isSparse INTEGER, diskOffset INTEGER
+        )
+    `)
+    if err != nil {
+        fmt.Println("[!] Error creating dataruns table:", err)
+        return false
+    }
+
+    // Every $FILE_NAME attribute of a record: hard links, DOS 8.3 short names and the Win32 name, each with its own parent and path
+    _, err = Database.Exec(`
+        CREATE TABLE names (
+            NID INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT, volumeID INTEGER, RID INTEGER, parentID INTEGER, parentSequence INTEGER, namespace TEXT, name TEXT, fnCreated INTEGER, fnModified INTEGER, fnMFTModified INTEGER, fnAccessed INTEGER, fnCreatedUTC TEXT, fnModifiedUTC TEXT, fnMFTModifiedUTC TEXT, fnAccessedUTC TEXT, fullPath TEXT, isOrphan INTEGER DEFAULT 0
+        )
+    `)
+    if err != nil {
+        fmt.Println("[!] Error creating names table:", err)
+        return false
+    }
+
+    // Alternate data streams (named $DATA attributes), their runs are in dataruns under the stream name
+    _, err = Database.Exec(`
+        CREATE TABLE streams (
+            volumeID INTEGER, RID INTEGER, name TEXT, isResident INTEGER, residentData BLOB, isCompressed INTEGER, compressionUnit INTEGER, streamLength INTEGER, fileOffset INTEGER, fileCluster INTEGER
+        )
+    `)
+    if err != nil {
+        fmt.Println("[!] Error creating streams table:", err)
+        return false
+    }
+
+    // Parsed Zone.Identifier streams, one row per downloaded file
+    _, err = Database.Exec(`
+        CREATE TABLE mark_of_the_web (
+            volumeID INTEGER, RID INTEGER, zoneID INTEGER, referrerUrl TEXT, hostUrl TEXT
+        )
+    `)
+    if err != nil {
+        fmt.Println("[!] Error creating mark_of_the_web table:", err)
+        return false
+    }
+
+    // Decoded $REPARSE_POINT attributes, targetPath is the substitute name (\??\C:\Users) of links and mount points
+    _, err = Database.Exec(`
+        CREATE TABLE reparse_points (
+            volumeID INTEGER, RID INTEGER, tag INTEGER, tagName TEXT, targetPath TEXT, printName TEXT, isRelative INTEGER
+        )
+    `)
+    if err != nil {
+        fmt.Println("[!] Error creating reparse_points table:", err)
+        return false
+    }
+
+    // Security descriptors from $Secure:$SDS, files refer to them by securityID
+    _, err = Database.Exec(`
+        CREATE TABLE security_descriptors (
+            volumeID INTEGER, securityID INTEGER, ownerSID TEXT, groupSID TEXT, sddl TEXT
+        )
+    `)
+    if err != nil {
+        fmt.Println("[!] Error creating security_descriptors table:", err)
+        return false
+    }
+
+    // The DACL entries of every security descriptor, in order
+    _, err = Database.Exec(`
+        CREATE TABLE aces (
+            volumeID INTEGER, securityID INTEGER, aceIndex INTEGER, aceType INTEGER, aceFlags INTEGER, accessMask INTEGER, sid TEXT
+        )
+    `)
+    if err != nil {
+        fmt.Println("[!] Error creating aces table:", err)
+        return false
+    }
+
+    // Results of the analysis passes run after the dump, one row per rule hit
+    _, err = Database.Exec(`
+        CREATE TABLE findings (
+            volumeID INTEGER, RID INTEGER, ruleID TEXT, explanation TEXT
+        )
+    `)
+    if err != nil {
+        fmt.Println("[!] Error creating findings table:", err)
+        return false
+    }
+
+    // One row per NTFS partition, RIDs are only unique within a volume
+    _, err = Database.Exec(`
+        CREATE TABLE volumes (
+            volumeID INTEGER NOT NULL PRIMARY KEY, partitionIndex INTEGER, partitionType TEXT, partitionGUID TEXT, volumeSerialNumber TEXT, partitionOffset INTEGER, clusterSize INTEGER
+        )
+    `)
+    if err != nil {
+        fmt.Println("[!] Error creating volumes table:", err)
+        return false
+    }
 	
 	// Create indexes to accelerate recursive path queries
-    _, err = Database.Exec(`CREATE INDEX idx_rid ON files(RID)`)
+    _, err = Database.Exec(`CREATE INDEX idx_rid ON files(volumeID, RID)`)
     if err != nil {
         fmt.Println("[!] Error creating RID index:", err)
         return false
     }
 
-    _, err = Database.Exec(`CREATE INDEX idx_parent ON files(parentID)`)
+    _, err = Database.Exec(`CREATE INDEX idx_parent ON files(volumeID, parentID)`)
     if err != nil {
         fmt.Println("[!] Error creating parentID index:", err)
         return false
     }
 
+    _, err = Database.Exec(`CREATE INDEX idx_dataruns ON dataruns(volumeID, RID, stream)`)
+    if err != nil {
+        fmt.Println("[!] Error creating dataruns index:", err)
+        return false
+    }
+
+    _, err = Database.Exec(`CREATE INDEX idx_names ON names(volumeID, RID)`)
+    if err != nil {
+        fmt.Println("[!] Error creating names index:", err)
+        return false
+    }
+
+    _, err = Database.Exec(`CREATE INDEX idx_streams ON streams(volumeID, RID)`)
+    if err != nil {
+        fmt.Println("[!] Error creating streams index:", err)
+        return false
+    }
+
+    _, err = Database.Exec(`CREATE INDEX idx_mark_of_the_web ON mark_of_the_web(volumeID, RID)`)
+    if err != nil {
+        fmt.Println("[!] Error creating mark_of_the_web index:", err)
+        return false
+    }
+
+    _, err = Database.Exec(`CREATE INDEX idx_reparse_points ON reparse_points(volumeID, RID)`)
+    if err != nil {
+        fmt.Println("[!] Error creating reparse_points index:", err)
+        return false
+    }
+
+    _, err = Database.Exec(`CREATE INDEX idx_security ON files(volumeID, securityID)`)
+    if err != nil {
+        fmt.Println("[!] Error creating securityID index:", err)
+        return false
+    }
+
+    _, err = Database.Exec(`CREATE INDEX idx_security_descriptors ON security_descriptors(volumeID, securityID)`)
+    if err != nil {
+        fmt.Println("[!] Error creating security_descriptors index:", err)
+        return false
+    }
+
+    _, err = Database.Exec(`CREATE INDEX idx_aces ON aces(volumeID, securityID)`)
+    if err != nil {
+        fmt.Println("[!] Error creating aces index:", err)
+        return false
+    }
+
     fmt.Println("[+] Database is clean and ready to use")
 	return true
 }
 
 
+// Opens an existing database for lookups, nothing is dropped
+func OpenSQLiteDB(dbFile string) bool {
+    var err error
+    Database, err = sql.Open("sqlite", dbFile)
+    if err != nil {
+        fmt.Println("[!] Error opening database:", err)
+        return false
+    }
+    if err = Database.Ping(); err != nil {
+        fmt.Println("[!] Failed to connect to database:", err)
+        return false
+    }
+    return true
+}
+
+
 /* Dump to DB functionality */
 
+// Every table filled during the dump shares the batch transaction, statements are prepared once per batch
+func batchStatement(query string) *sql.Stmt {
+    var err error
+    if Tx == nil {
+        Tx, err = Database.Begin()
+        if err != nil {
+            fmt.Println("[!] Failed to begin transaction:", err)
+            return nil
+        }
+    }
+    stmt, ok := Stmts[query]
+    if !ok {
+        stmt, err = Tx.Prepare(query)
+        if err != nil {
+            fmt.Println("[!] Failed to prepare statement:", err)
+            return nil
+        }
+        Stmts[query] = stmt
+    }
+    return stmt
+}
+
 func FlushBatch() {
     if Tx == nil {
         return
     }
-    err := Stmt.Close()
-    if err != nil {
-        fmt.Println("[!] Error closing statement:", err)
-    }
-    err = Tx.Commit()
-    if err != nil {
-        fmt.Println("[!] Error committing transaction:", err)
-    } else {
+    if commitTransaction() {
         InsertCounter += Batch
         fmt.Printf("[.] Committed batch of %d records. Total inserted: %d\n", Batch, InsertCounter)
     }
     // Reset for next batch
-    Tx = nil
-    Stmt = nil
     Batch = 0
 }
 
+// Closes the prepared statements of the open transaction and commits it
+func commitTransaction() bool {
+    for query, stmt := range Stmts {
+        err := stmt.Close()
+        if err != nil {
+            fmt.Println("[!] Error closing statement:", err)
+        }
+        delete(Stmts, query)
+    }
+    err := Tx.Commit()
+    Tx = nil
+    if err != nil {
+        fmt.Println("[!] Error committing transaction:", err)
+        return false
+    }
+    return true
+}
 
-func InsertFileRecord(RID int, filename string, parentID int, isFolder int, isActive int, fullOffset int, dataLength int) {
-    if Tx == nil {
-        var err error
-        Tx, err = Database.Begin()
+
+func InsertVolume(volume internal.VOLUME_INFO) {
+    // A standalone $MFT file comes without its boot sector, so the cluster size isn't known
+    var clusterSize interface{}
+    if volume.ClusterSize != 0 {
+        clusterSize = int64(volume.ClusterSize)
+    }
+    _, err := Database.Exec("INSERT INTO volumes (volumeID, partitionIndex, partitionType, partitionGUID, volumeSerialNumber, partitionOffset, clusterSize) VALUES (?, ?, ?, ?, ?, ?, ?)",
+        volume.VolumeID, volume.PartitionIndex, volume.PartitionType, volume.PartitionGUID, fmt.Sprintf("%016X", volume.VolumeSerialNumber), int64(volume.NTFSOffset), clusterSize)
+    if err != nil {
+        fmt.Println("[!] Error inserting volume:", err)
+    }
+}
+
+func InsertFileRecord(volume internal.VOLUME_INFO, fileInformation internal.FILE_INFO) {
+    stmt := batchStatement("INSERT INTO files (volumeID, RID, sequence, parentID, parentSequence, filename, fileOffset, fileCluster, fileLength, isResident, residentData, isCompressed, compressionUnit, wofCompression, isFolder, isActive, isCorrupt, securityID, siCreated, siModified, siMFTModified, siAccessed, siCreatedUTC, siModifiedUTC, siMFTModifiedUTC, siAccessedUTC, fnCreated, fnModified, fnMFTModified, fnAccessed, fnCreatedUTC, fnModifiedUTC, fnMFTModifiedUTC, fnAccessedUTC) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)")
+    if stmt == nil {
+        return
+    }
+
+    // Without a disk (standalone $MFT file) there is no partition base, only the cluster number can be stored
+    var fileOffset, fileCluster interface{}
+    if !volume.StandaloneMFT {
+        fileOffset = int64(fileInformation.FullDataOffset)
+    }
+    if fileInformation.HasDataRun {
+        fileCluster = int64(fileInformation.DataCluster)
+    }
+    var wofCompression interface{}
+    if fileInformation.IsWofCompressed {
+        wofCompression = internal.WofAlgorithmToString(fileInformation.WofAlgorithm)
+    }
+    var securityID interface{}
+    if fileInformation.SecurityID != 0 {
+        securityID = int64(fileInformation.SecurityID)
+    }
+
+    _, err := stmt.Exec(volume.VolumeID, int(fileInformation.RecordID), int(fileInformation.SequenceNumber), int64(fileInformation.ParentDirectory), int(fileInformation.ParentSequence), fileInformation.FileName, fileOffset, fileCluster, int64(fileInformation.DataLength), internal.BoolToInt(fileInformation.IsResident), residentDataValue(fileInformation.ResidentData), internal.BoolToInt(fileInformation.IsCompressed), compressionUnitValue(fileInformation.IsCompressed, fileInformation.CompressionUnit), wofCompression, internal.BoolToInt(fileInformation.IsFolder), internal.BoolToInt(fileInformation.IsActive), internal.BoolToInt(fileInformation.IsCorrupt), securityID,
+        int64(fileInformation.FileCreatedUTCWinFileEpoch), int64(fileInformation.FileModifiedUTCWinFileEpoch), int64(fileInformation.FileRecordModifiedUTCWinFileEpoch), int64(fileInformation.FileLastReadUTCWinFileEpoch),
+        internal.FiletimeToISO8601(fileInformation.FileCreatedUTCWinFileEpoch), internal.FiletimeToISO8601(fileInformation.FileModifiedUTCWinFileEpoch), internal.FiletimeToISO8601(fileInformation.FileRecordModifiedUTCWinFileEpoch), internal.FiletimeToISO8601(fileInformation.FileLastReadUTCWinFileEpoch),
+        int64(fileInformation.FileNameCreatedUTCWinFileEpoch), int64(fileInformation.FileNameModifiedUTCWinFileEpoch), int64(fileInformation.FileNameRecordModifiedUTCWinFileEpoch), int64(fileInformation.FileNameLastReadUTCWinFileEpoch),
+        internal.FiletimeToISO8601(fileInformation.FileNameCreatedUTCWinFileEpoch), internal.FiletimeToISO8601(fileInformation.FileNameModifiedUTCWinFileEpoch), internal.FiletimeToISO8601(fileInformation.FileNameRecordModifiedUTCWinFileEpoch), internal.FiletimeToISO8601(fileInformation.FileNameLastReadUTCWinFileEpoch))
+    if err != nil {
+        fmt.Println("[!] Insert error:", err)
+        return
+    }
+    insertDataRuns(volume, int(fileInformation.RecordID), "", fileInformation.DataRuns)
+    insertNames(volume, int(fileInformation.RecordID), fileInformation.FileNames)
+    insertStreams(volume, int(fileInformation.RecordID), fileInformation.Streams)
+    if fileInformation.HasMarkOfTheWeb {
+        insertMarkOfTheWeb(volume, int(fileInformation.RecordID), fileInformation.MarkOfTheWeb)
+    }
+    if fileInformation.HasReparsePoint {
+        insertReparsePoint(volume, int(fileInformation.RecordID), fileInformation.ReparsePoint)
+    }
+
+    Batch++
+    if Batch%BatchSize == 0 {
+        FlushBatch()
+    }
+}
+
+
+// Resident content is only stored when it fits within ResidentDataLimit, larger files are carved from the MFT record
+func residentDataValue(residentData []byte) interface{} {
+    if residentData == nil || len(residentData) > ResidentDataLimit {
+        return nil
+    }
+    return residentData
+}
+
+
+// Clusters per compression unit, taken from the attribute header. Only compressed data has one.
+func compressionUnitValue(isCompressed bool, compressionUnit uint32) interface{} {
+    if !isCompressed {
+        return nil
+    }
+    return int64(compressionUnit)
+}
+
+
+// Every extent of the file, in VCN order. Sparse runs have no LCN and no disk offset.
+func insertDataRuns(volume internal.VOLUME_INFO, RID int, stream string, dataRuns []internal.DATA_RUN) {
+    if len(dataRuns) == 0 {
+        return
+    }
+    runStmt := batchStatement("INSERT INTO dataruns (volumeID, RID, stream, VCN, LCN, clusterCount, isSparse, diskOffset) VALUES (?, ?, ?, ?, ?, ?, ?, ?)")
+    if runStmt == nil {
+        return
+    }
+    for _, dataRun := range dataRuns {
+        var LCN, diskOffset interface{}
+        if !dataRun.IsSparse {
+            LCN = dataRun.LCN
+            if !volume.StandaloneMFT {
+                diskOffset = int64(volume.NTFSOffset) + dataRun.AbsoluteOffsetWithinNTFSPartition
+            }
+        }
+        _, err := runStmt.Exec(volume.VolumeID, RID, stream, dataRun.VCN, LCN, dataRun.ClusterCount, internal.BoolToInt(dataRun.IsSparse), diskOffset)
         if err != nil {
-            fmt.Println("[!] Failed to begin transaction:", err)
+            fmt.Println("[!] Insert error (data run):", err)
             return
         }
-        Stmt, err = Tx.Prepare("INSERT INTO files (RID, parentID, filename, fileOffset, fileLength, isFolder, isActive) VALUES (?, ?, ?, ?, ?, ?, ?)")
+    }
+}
+
+
+func insertStreams(volume internal.VOLUME_INFO, RID int, dataStreams []internal.STREAM_INFO) {
+    if len(dataStreams) == 0 {
+        return
+    }
+    streamStmt := batchStatement("INSERT INTO streams (volumeID, RID, name, isResident, residentData, isCompressed, compressionUnit, streamLength, fileOffset, fileCluster) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)")
+    if streamStmt == nil {
+        return
+    }
+    for _, dataStream := range dataStreams {
+        var fileOffset, fileCluster interface{}
+        if !volume.StandaloneMFT {
+            fileOffset = int64(dataStream.FullDataOffset)
+        }
+        if dataStream.HasDataRun {
+            fileCluster = int64(dataStream.DataCluster)
+        }
+        _, err := streamStmt.Exec(volume.VolumeID, RID, dataStream.Name, internal.BoolToInt(dataStream.IsResident), residentDataValue(dataStream.ResidentData), internal.BoolToInt(dataStream.IsCompressed), compressionUnitValue(dataStream.IsCompressed, dataStream.CompressionUnit), int64(dataStream.DataLength), fileOffset, fileCluster)
         if err != nil {
-            fmt.Println("[!] Failed to prepare statement:", err)
+            fmt.Println("[!] Insert error (stream):", err)
             return
         }
+        insertDataRuns(volume, RID, dataStream.Name, dataStream.DataRuns)
     }
+}
 
-    _, err := Stmt.Exec(RID, parentID, filename, fullOffset, dataLength, isFolder, isActive)
+func insertMarkOfTheWeb(volume internal.VOLUME_INFO, RID int, markOfTheWeb internal.MARK_OF_THE_WEB) {
+    motwStmt := batchStatement("INSERT INTO mark_of_the_web (volumeID, RID, zoneID, referrerUrl, hostUrl) VALUES (?, ?, ?, ?, ?)")
+    if motwStmt == nil {
+        return
+    }
+    var zoneID interface{}
+    if markOfTheWeb.ZoneID >= 0 {
+        zoneID = markOfTheWeb.ZoneID
+    }
+    _, err := motwStmt.Exec(volume.VolumeID, RID, zoneID, markOfTheWeb.ReferrerUrl, markOfTheWeb.HostUrl)
     if err != nil {
-        fmt.Println("[!] Insert error:", err)
+        fmt.Println("[!] Insert error (mark of the web):", err)
+    }
+}
+
+func insertReparsePoint(volume internal.VOLUME_INFO, RID int, reparsePoint internal.REPARSE_POINT) {
+    reparseStmt := batchStatement("INSERT INTO reparse_points (volumeID, RID, tag, tagName, targetPath, printName, isRelative) VALUES (?, ?, ?, ?, ?, ?, ?)")
+    if reparseStmt == nil {
         return
     }
+    _, err := reparseStmt.Exec(volume.VolumeID, RID, int64(reparsePoint.Tag), internal.ReparsePointToString(reparsePoint), reparsePoint.TargetPath, reparsePoint.PrintName, internal.BoolToInt(reparsePoint.IsRelative))
+    if err != nil {
+        fmt.Println("[!] Insert error (reparse point):", err)
+    }
+}
 
-    Batch++
-    if Batch%BatchSize == 0 {
-        FlushBatch()
+// Stored once per volume, in security ID order
+func InsertSecurityDescriptors(volume internal.VOLUME_INFO, securityDescriptors map[uint32]internal.SECURITY_DESCRIPTOR) {
+    securityIDs := make([]int, 0, len(securityDescriptors))
+    for securityID := range securityDescriptors {
+        securityIDs = append(securityIDs, int(securityID))
+    }
+    sort.Ints(securityIDs)
+    for _, securityID := range securityIDs {
+        securityDescriptor := securityDescriptors[uint32(securityID)]
+        descriptorStmt := batchStatement("INSERT INTO security_descriptors (volumeID, securityID, ownerSID, groupSID, sddl) VALUES (?, ?, ?, ?, ?)")
+        if descriptorStmt == nil {
+            return
+        }
+        _, err := descriptorStmt.Exec(volume.VolumeID, securityID, securityDescriptor.OwnerSID, securityDescriptor.GroupSID, securityDescriptor.SDDL)
+        if err != nil {
+            fmt.Println("[!] Insert error (security descriptor):", err)
+            continue
+        }
+        for aceIndex, accessControlEntry := range securityDescriptor.DACL {
+            aceStmt := batchStatement("INSERT INTO aces (volumeID, securityID, aceIndex, aceType, aceFlags, accessMask, sid) VALUES (?, ?, ?, ?, ?, ?, ?)")
+            if aceStmt == nil {
+                return
+            }
+            _, err := aceStmt.Exec(volume.VolumeID, securityID, aceIndex, int(accessControlEntry.Type), int(accessControlEntry.Flags), int64(accessControlEntry.AccessMask), accessControlEntry.SID)
+            if err != nil {
+                fmt.Println("[!] Insert error (ACE):", err)
+            }
+        }
+    }
+    // The descriptors aren't file records, they don't count towards the batch
+    if Tx != nil {
+        commitTransaction()
     }
 }
 
+func insertNames(volume internal.VOLUME_INFO, RID int, fileNames []internal.FILE_NAME_INFO) {
+    if len(fileNames) == 0 {
+        return
+    }
+    nameStmt := batchStatement("INSERT INTO names (volumeID, RID, parentID, parentSequence, namespace, name, fnCreated, fnModified, fnMFTModified, fnAccessed, fnCreatedUTC, fnModifiedUTC, fnMFTModifiedUTC, fnAccessedUTC) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)")
+    if nameStmt == nil {
+        return
+    }
+    for _, fileName := range fileNames {
+        _, err := nameStmt.Exec(volume.VolumeID, RID, int64(fileName.ParentDirectory), int(fileName.ParentSequence), internal.NamespaceToString(fileName.Namespace), fileName.Name,
+            int64(fileName.CreatedUTCWinFileEpoch), int64(fileName.ModifiedUTCWinFileEpoch), int64(fileName.RecordModifiedUTCWinFileEpoch), int64(fileName.LastReadUTCWinFileEpoch),
+            internal.FiletimeToISO8601(fileName.CreatedUTCWinFileEpoch), internal.FiletimeToISO8601(fileName.ModifiedUTCWinFileEpoch), internal.FiletimeToISO8601(fileName.RecordModifiedUTCWinFileEpoch), internal.FiletimeToISO8601(fileName.LastReadUTCWinFileEpoch))
+        if err != nil {
+            fmt.Println("[!] Insert error (name):", err)
+            return
+        }
+    }
+}
+
+
+/* Carve support */
+// Rebuilds the volume and file information (including the run list) of a stored file record, as needed for carving.
+// With a stream name the alternate data stream is loaded instead of the file content.
+func LoadFileRecord(FID int, stream string) (internal.VOLUME_INFO, internal.FILE_INFO, bool) {
+    var volume internal.VOLUME_INFO
+    var fileInformation internal.FILE_INFO
+    var fileOffset, clusterSize, compressionUnit sql.NullInt64
+    var partitionGUID, wofCompression sql.NullString
+    var serialNumber string
+    var partitionOffset int64
+    var RID, isResident, isCompressed int
+
+    query := `SELECT f.RID, f.filename, f.fileOffset, f.fileLength, f.isResident, f.residentData, f.isCompressed, f.compressionUnit, f.wofCompression, v.volumeID, v.partitionIndex, v.partitionType, v.partitionGUID, v.volumeSerialNumber, v.partitionOffset, v.clusterSize
+        FROM files f JOIN volumes v ON v.volumeID = f.volumeID WHERE f.FID = ?`
+    err := Database.QueryRow(query, FID).Scan(&RID, &fileInformation.FileName, &fileOffset, &fileInformation.DataLength, &isResident, &fileInformation.ResidentData, &isCompressed, &compressionUnit, &wofCompression,
+        &volume.VolumeID, &volume.PartitionIndex, &volume.PartitionType, &partitionGUID, &serialNumber, &partitionOffset, &clusterSize)
+    if err != nil {
+        fmt.Println("[!] Unable to load file record:", err)
+        return volume, fileInformation, false
+    }
+    fileInformation.RecordID = uint32(RID)
+    fileInformation.IsResident = isResident == 1
+    fileInformation.IsCompressed = isCompressed == 1
+    fileInformation.FullDataOffset = uint64(fileOffset.Int64)
+    volume.PartitionGUID = partitionGUID.String
+    volume.NTFSOffset = uint64(partitionOffset)
+    volume.ClusterSize = uint32(clusterSize.Int64)
+    volume.VolumeSerialNumber, _ = strconv.ParseUint(serialNumber, 16, 64)
+    volume.StandaloneMFT = !fileOffset.Valid
+
+    // An alternate data stream replaces the main stream, so the file can be carved as usual
+    if stream != "" {
+        err = Database.QueryRow("SELECT streamLength, isResident, residentData, isCompressed, compressionUnit, fileOffset FROM streams WHERE volumeID = ? AND RID = ? AND name = ?", volume.VolumeID, RID, stream).Scan(&fileInformation.DataLength, &isResident, &fileInformation.ResidentData, &isCompressed, &compressionUnit, &fileOffset)
+        if err != nil {
+            fmt.Println("[!] Unable to find stream", stream+":", err)
+            return volume, fileInformation, false
+        }
+        fileInformation.FileName = fileInformation.FileName + ":" + stream
+        fileInformation.IsResident = isResident == 1
+        fileInformation.IsCompressed = isCompressed == 1
+        fileInformation.FullDataOffset = uint64(fileOffset.Int64)
+    }
+    fileInformation.CompressionUnit = uint32(compressionUnit.Int64)
+
+    var ok bool
+    fileInformation.DataRuns, ok = LoadDataRuns(volume, RID, stream)
+    if !ok {
+        return volume, fileInformation, false
+    }
+    // The content of a WOF compressed file is in its WofCompressedData stream, the unnamed $DATA is sparse
+    if wofCompression.Valid && stream == "" {
+        fileInformation.IsWofCompressed = true
+        for algorithm, name := range internal.WofAlgorithms {
+            if name == wofCompression.String {
+                fileInformation.WofAlgorithm = uint32(algorithm)
+            }
+        }
+        wofStream := internal.STREAM_INFO{Name: "WofCompressedData"}
+        err = Database.QueryRow("SELECT streamLength, isResident, residentData FROM streams WHERE volumeID = ? AND RID = ? AND name = ?", volume.VolumeID, RID, wofStream.Name).Scan(&wofStream.DataLength, &isResident, &wofStream.ResidentData)
+        if err != nil {
+            fmt.Println("[!] Unable to find stream", wofStream.Name+":", err)
+            return volume, fileInformation, false
+        }
+        wofStream.IsResident = isResident == 1
+        if wofStream.DataRuns, ok = LoadDataRuns(volume, RID, wofStream.Name); !ok {
+            return volume, fileInformation, false
+        }
+        wofStream.HasDataRun = len(wofStream.DataRuns) > 0
+        fileInformation.Streams = append(fileInformation.Streams, wofStream)
+    }
+    fileInformation.HasDataRun = len(fileInformation.DataRuns) > 0
+    // An empty BLOB reads back as nil, which would look like content that wasn't stored
+    if fileInformation.IsResident && fileInformation.DataLength == 0 {
+        fileInformation.ResidentData = []byte{}
+    }
+    return volume, fileInformation, true
+}
+
+
+// The run list of a file (or one of its alternate data streams) in VCN order, as stored during the dump
+func LoadDataRuns(volume internal.VOLUME_INFO, RID int, stream string) ([]internal.DATA_RUN, bool) {
+    var dataRuns []internal.DATA_RUN
+    rows, err := Database.Query("SELECT VCN, LCN, clusterCount, isSparse FROM dataruns WHERE volumeID = ? AND RID = ? AND stream = ? ORDER BY VCN", volume.VolumeID, RID, stream)
+    if err != nil {
+        fmt.Println("[!] Unable to load data runs:", err)
+        return nil, false
+    }
+    defer rows.Close()
+    for rows.Next() {
+        var dataRun internal.DATA_RUN
+        var LCN sql.NullInt64
+        var isSparse int
+        if err := rows.Scan(&dataRun.VCN, &LCN, &dataRun.ClusterCount, &isSparse); err != nil {
+            fmt.Println("[!] Failed to read data run:", err)
+            return nil, false
+        }
+        dataRun.LCN = LCN.Int64
+        dataRun.IsSparse = isSparse == 1
+        dataRun.AbsoluteOffsetWithinNTFSPartition = dataRun.LCN * int64(volume.ClusterSize)
+        dataRuns = append(dataRuns, dataRun)
+    }
+    return dataRuns, true
+}
+
+
+// Looks up the file IDs matching a full path, including hard link and short name paths (or RID when path is empty), volumeID 0 searches all volumes
+func FindFileIDs(path string, RID int, volumeID int) []int {
+    var FIDs []int
+    query := "SELECT FID FROM files WHERE (fullPath = ? COLLATE NOCASE OR (volumeID, RID) IN (SELECT volumeID, RID FROM names WHERE fullPath = ? COLLATE NOCASE)) AND (? = 0 OR volumeID = ?)"
+    args := []interface{}{path, path, volumeID, volumeID}
+    if path == "" {
+        query = "SELECT FID FROM files WHERE RID = ? AND (? = 0 OR volumeID = ?)"
+        args = []interface{}{RID, volumeID, volumeID}
+    }
+    rows, err := Database.Query(query, args...)
+    if err != nil {
+        fmt.Println("[!] Query failed:", err)
+        return FIDs
+    }
+    defer rows.Close()
+    for rows.Next() {
+        var FID int
+        if err := rows.Scan(&FID); err == nil {
+            FIDs = append(FIDs, FID)
+        }
+    }
+    return FIDs
+}
+
 
 /* enrichment of collected data */
-func fetchAllFiles() (map[int]*sqlDBFileEntry, error) {
-    rows, err := Database.Query("SELECT FID, RID, parentID, filename FROM files")
+// Entries are grouped per volume, as parent RIDs only point within their own volume
+func fetchAllFiles() (map[int]map[int]*sqlDBFileEntry, error) {
+    rows, err := Database.Query("SELECT FID, volumeID, RID, sequence, parentID, parentSequence, isActive, filename FROM files")
     if err != nil {
         return nil, err
     }
     defer rows.Close()
 
-    entries := make(map[int]*sqlDBFileEntry)
+    volumes := make(map[int]map[int]*sqlDBFileEntry)
     for rows.Next() {
         var f sqlDBFileEntry
-        if err := rows.Scan(&f.FID, &f.RID, &f.ParentID, &f.Filename); err != nil {
+        if err := rows.Scan(&f.FID, &f.VolumeID, &f.RID, &f.Sequence, &f.ParentID, &f.ParentSequence, &f.IsActive, &f.Filename); err != nil {
             return nil, err
         }
-        entries[f.RID] = &f
+        if volumes[f.VolumeID] == nil {
+            volumes[f.VolumeID] = make(map[int]*sqlDBFileEntry)
+        }
+        volumes[f.VolumeID][f.RID] = &f
+    }
+    return volumes, nil
+}
+
+// Like The Sleuth Kit, files whose parent chain doesn't lead back to the root are placed in a virtual directory.
+// As much of the chain as is still intact is kept, e.g. $OrphanFiles\Folder B\file.txt when only Folder B lost its parent.
+const OrphanFilesRoot = "$OrphanFiles"
+
+// Returns the parent, but only if its record slot still holds the directory the reference was made to.
+// Deleting a record increments its sequence number, so a deleted parent may be exactly one ahead.
+func lookupParent(entries map[int]*sqlDBFileEntry, parentID int, parentSequence int) *sqlDBFileEntry {
+    parent, ok := entries[parentID]
+    if !ok {
+        return nil
+    }
+    if parentSequence == 0 || parent.Sequence == parentSequence || (!parent.IsActive && parent.Sequence == parentSequence+1) {
+        return parent
     }
-    return entries, nil
+    return nil
 }
 
 func buildFullPath(entries map[int]*sqlDBFileEntry, rid int) string {
@@ -153,19 +696,27 @@ func buildFullPath(entries map[int]*sqlDBFileEntry, rid int) string {
     if !ok {
         return ""
     }
-    if entry.FullPath != "" {
+    if entry.FullPath != "" || entry.visiting || entry.Filename == "" {
         return entry.FullPath
     }
 
     if entry.ParentID == entry.RID || entry.ParentID == 5 {
         entry.FullPath = entry.Filename
+        return entry.FullPath
+    }
+    parentPath := ""
+    parent := lookupParent(entries, entry.ParentID, entry.ParentSequence)
+    if parent != nil {
+        entry.visiting = true
+        parentPath = buildFullPath(entries, parent.RID)
+        entry.visiting = false
+    }
+    if parentPath == "" {
+        entry.FullPath = OrphanFilesRoot + `\` + entry.Filename
+        entry.IsOrphan = true
     } else {
-        parentPath := buildFullPath(entries, entry.ParentID)
-        if parentPath == "" {
-            entry.FullPath = entry.Filename
-        } else {
-            entry.FullPath = parentPath + `\` + entry.Filename
-        }
+        entry.FullPath = parentPath + `\` + entry.Filename
+        entry.IsOrphan = parent.IsOrphan
     }
     return entry.FullPath
 }
@@ -174,15 +725,17 @@ func UpdateFullpaths() {
     fmt.Println("\n[+] Building full paths for all entries...")
 
     // Step 1: Fetch all entries into memory
-    files, err := fetchAllFiles()
+    volumes, err := fetchAllFiles()
     if err != nil {
         fmt.Println("[!] Failed to load records:", err)
         return
     }
 
     // Step 2: Build fullpaths recursively
-    for rid := range files {
-        _ = buildFullPath(files, rid)
+    for _, files := range volumes {
+        for rid := range files {
+            _ = buildFullPath(files, rid)
+        }
     }
 
     // Step 3: Begin bulk update
@@ -192,22 +745,24 @@ func UpdateFullpaths() {
         return
     }
 
-    Stmt, err := Tx.Prepare("UPDATE files SET fullpath = ? WHERE RID = ?")
+    Stmt, err := Tx.Prepare("UPDATE files SET fullpath = ?, isOrphan = ? WHERE volumeID = ? AND RID = ?")
     if err != nil {
         fmt.Println("[!] Failed to prepare update statement:", err)
         return
     }
 
     count := 0
-    for rid, entry := range files {
-        if entry.FullPath != "" {
-            _, err := Stmt.Exec(entry.FullPath, rid)
-            if err != nil {
-                fmt.Printf("[!!] Failed to update RID %d: %v\n", rid, err)
-            }
-            count++
-            if count%100000 == 0 {
-                fmt.Printf("[+] Updated %d fullpaths...\n", count)
+    for volumeID, files := range volumes {
+        for rid, entry := range files {
+            if entry.FullPath != "" {
+                _, err := Stmt.Exec(entry.FullPath, internal.BoolToInt(entry.IsOrphan), volumeID, rid)
+                if err != nil {
+                    fmt.Printf("[!!] Failed to update RID %d on volume %d: %v\n", rid, volumeID, err)
+                }
+                count++
+                if count%100000 == 0 {
+                    fmt.Printf("[+] Updated %d fullpaths...\n", count)
+                }
             }
         }
     }
@@ -220,4 +775,335 @@ func UpdateFullpaths() {
     }
 
     fmt.Println("[+] Fullpaths updated for", count, "records.")
+    updateNamePaths(volumes)
+}
+
+// Every name gets the path through its own parent, which gives each hard link (and the DOS short name) its own full path
+func updateNamePaths(volumes map[int]map[int]*sqlDBFileEntry) {
+    rows, err := Database.Query("SELECT NID, volumeID, RID, parentID, parentSequence, name FROM names")
+    if err != nil {
+        fmt.Println("[!] Failed to load names:", err)
+        return
+    }
+    namePaths := make(map[int]*sqlDBFileEntry)
+    for rows.Next() {
+        var NID, volumeID int
+        name := &sqlDBFileEntry{}
+        if err := rows.Scan(&NID, &volumeID, &name.RID, &name.ParentID, &name.ParentSequence, &name.Filename); err != nil {
+            fmt.Println("[!] Failed to read name:", err)
+            rows.Close()
+            return
+        }
+        namePaths[NID] = name
+        if name.ParentID == name.RID || name.ParentID == 5 {
+            name.FullPath = name.Filename
+            continue
+        }
+        parentPath := ""
+        parent := lookupParent(volumes[volumeID], name.ParentID, name.ParentSequence)
+        if parent != nil {
+            parentPath = buildFullPath(volumes[volumeID], parent.RID)
+        }
+        if parentPath == "" {
+            name.FullPath = OrphanFilesRoot + `\` + name.Filename
+            name.IsOrphan = true
+        } else {
+            name.FullPath = parentPath + `\` + name.Filename
+            name.IsOrphan = parent.IsOrphan
+        }
+    }
+    rows.Close()
+
+    Tx, err := Database.Begin()
+    if err != nil {
+        fmt.Println("[!] Failed to begin transaction:", err)
+        return
+    }
+    Stmt, err := Tx.Prepare("UPDATE names SET fullPath = ?, isOrphan = ? WHERE NID = ?")
+    if err != nil {
+        fmt.Println("[!] Failed to prepare update statement:", err)
+        return
+    }
+    for NID, name := range namePaths {
+        if _, err := Stmt.Exec(name.FullPath, internal.BoolToInt(name.IsOrphan), NID); err != nil {
+            fmt.Printf("[!!] Failed to update name %d: %v\n", NID, err)
+        }
+    }
+    Stmt.Close()
+    if err = Tx.Commit(); err != nil {
+        fmt.Println("[!] Commit failed:", err)
+        return
+    }
+    fmt.Println("[+] Fullpaths updated for", len(namePaths), "names (including hard links and short names).")
+}
+
+
+
+/* Timestomping analysis */
+type timestompRule struct {
+    ruleID      string
+    condition   string      // SQL condition on the files table
+    explanation string      // SQL expression, so the actual times end up in the finding
+}
+
+// The install date of a volume is taken from the creation time of $MFT (RID 0), which is set when the volume is formatted
+const volumeInstallDate = "(SELECT m.siCreated FROM files m WHERE m.volumeID = files.volumeID AND m.RID = 0)"
+
+var timestompRules = []timestompRule{
+    {"TS01", "siCreated < fnCreated",
+        "'SI created ' || siCreatedUTC || ' is earlier than FN created ' || fnCreatedUTC"},
+    {"TS02", "(siCreated % 10000000 = 0 OR siModified % 10000000 = 0)",
+        "'SI ' || CASE WHEN siCreated % 10000000 = 0 THEN 'created ' || siCreatedUTC ELSE 'modified ' || siModifiedUTC END || ' has no sub-second precision'"},
+    {"TS03", "siCreated < " + volumeInstallDate,
+        "'SI created ' || siCreatedUTC || ' is earlier than the volume install date (creation of $MFT)'"},
+    {"TS04", "siMFTModified < siCreated",
+        "'SI MFT modified ' || siMFTModifiedUTC || ' is earlier than SI created ' || siCreatedUTC"},
+}
+
+// Flags the classic timestomping indicators, this needs both the SI and FN timestamps of every record
+func DetectTimestomping() {
+    fmt.Println("\n[+] Running timestomping analysis...")
+    for _, rule := range timestompRules {
+        result, err := Database.Exec(`INSERT INTO findings (volumeID, RID, ruleID, explanation)
+            SELECT volumeID, RID, '` + rule.ruleID + `', ` + rule.explanation + ` FROM files
+            WHERE isCorrupt = 0 AND siCreated <> 0 AND fnCreated <> 0 AND ` + rule.condition)
+        if err != nil {
+            fmt.Println("[!] Failed to run rule", rule.ruleID+":", err)
+            continue
+        }
+        hits, _ := result.RowsAffected()
+        fmt.Printf("  --> Rule %s flagged %d records\n", rule.ruleID, hits)
+    }
+}
+
+// Prints all findings, optionally restricted to one volume (volumeID 0 = all volumes)
+func PrintFindings(volumeID int) bool {
+    rows, err := Database.Query(`SELECT f.ruleID, f.volumeID, f.RID, COALESCE(files.fullPath, files.filename, ''), f.explanation
+        FROM findings f LEFT JOIN files ON files.volumeID = f.volumeID AND files.RID = f.RID
+        WHERE (? = 0 OR f.volumeID = ?) ORDER BY f.ruleID, f.volumeID, f.RID`, volumeID, volumeID)
+    if err != nil {
+        fmt.Println("[!] Query failed:", err)
+        return false
+    }
+    defer rows.Close()
+
+    count := 0
+    for rows.Next() {
+        var ruleID, fullPath, explanation string
+        var volume, RID int
+        if err := rows.Scan(&ruleID, &volume, &RID, &fullPath, &explanation); err != nil {
+            fmt.Println("[!] Failed to read finding:", err)
+            return false
+        }
+        fmt.Printf("[%s] volume %d, RID %d: %s\n       %s\n", ruleID, volume, RID, fullPath, explanation)
+        count++
+    }
+    fmt.Println("[+] Total findings:", count)
+    return true
+}
+
+
+// Every file carrying a Mark of the Web, with the zone and the URL it was downloaded from
+func PrintDownloads(volumeID int) bool {
+    rows, err := Database.Query(`SELECT m.volumeID, m.RID, COALESCE(files.fullPath, files.filename, ''), COALESCE(m.zoneID, -1), m.referrerUrl, m.hostUrl
+        FROM mark_of_the_web m LEFT JOIN files ON files.volumeID = m.volumeID AND files.RID = m.RID
+        WHERE (? = 0 OR m.volumeID = ?) ORDER BY m.volumeID, files.fullPath`, volumeID, volumeID)
+    if err != nil {
+        fmt.Println("[!] Query failed:", err)
+        return false
+    }
+    defer rows.Close()
+
+    count := 0
+    for rows.Next() {
+        var volume, RID, zoneID int
+        var fullPath, referrerUrl, hostUrl string
+        if err := rows.Scan(&volume, &RID, &fullPath, &zoneID, &referrerUrl, &hostUrl); err != nil {
+            fmt.Println("[!] Failed to read mark of the web:", err)
+            return false
+        }
+        fmt.Printf("[%s] volume %d, RID %d: %s\n", internal.ZoneIDToString(zoneID), volume, RID, fullPath)
+        if hostUrl != "" {
+            fmt.Println("       Host URL:", hostUrl)
+        }
+        if referrerUrl != "" {
+            fmt.Println("       Referrer URL:", referrerUrl)
+        }
+        count++
+    }
+    fmt.Println("[+] Total downloaded files:", count)
+    return true
+}
+
+
+// Rights that let a trustee change a file or the content of a folder: write/add file, append/add subdirectory, WRITE_DAC, WRITE_OWNER, GENERIC_WRITE and GENERIC_ALL
+const writeAccessMask = 0x00000002 | 0x00000004 | 0x00040000 | 0x00080000 | 0x40000000 | 0x10000000
+
+// Active files whose DACL allows Everyone, Authenticated Users or Users to write, deny ACEs aren't taken into account.
+// Inherit-only ACEs are skipped, they only apply to the children of a folder.
+func PrintWritableFiles(volumeID int) bool {
+    rows, err := Database.Query(`SELECT f.volumeID, f.RID, COALESCE(f.fullPath, f.filename, ''), f.isFolder, a.sid, a.accessMask
+        FROM aces a JOIN files f ON f.volumeID = a.volumeID AND f.securityID = a.securityID
+        WHERE a.aceType = 0 AND (a.aceFlags & 8) = 0 AND (a.accessMask & ?) != 0 AND a.sid IN ('S-1-1-0', 'S-1-5-11', 'S-1-5-32-545')
+        AND f.isActive = 1 AND (? = 0 OR f.volumeID = ?) ORDER BY f.volumeID, f.fullPath`, writeAccessMask, volumeID, volumeID)
+    if err != nil {
+        fmt.Println("[!] Query failed:", err)
+        return false
+    }
+    defer rows.Close()
+
+    count := 0
+    for rows.Next() {
+        var volume, RID, isFolder int
+        var fullPath, sid string
+        var accessMask int64
+        if err := rows.Scan(&volume, &RID, &fullPath, &isFolder, &sid, &accessMask); err != nil {
+            fmt.Println("[!] Failed to read ACE:", err)
+            return false
+        }
+        fileType := "file"
+        if isFolder == 1 {
+            fileType = "folder"
+        }
+        fmt.Printf("[%s] volume %d, RID %d (%s): %s, access mask 0x%x\n", internal.SIDToName(sid), volume, RID, fileType, fullPath, accessMask)
+        count++
+    }
+    fmt.Println("[+] Total writable entries:", count)
+    return true
+}
+
+
+/* Deleted file recovery */
+type runAllocation struct {
+    hasAllocated   bool
+    hasUnallocated bool
+}
+
+// Looks up the clusters of a run in the $Bitmap, whole bytes (8 clusters) are tested at once where the run covers them.
+// The scan stops as soon as the run is known to hold both allocated and unallocated clusters.
+func checkRunAllocation(clusterBitmap []byte, LCN int64, clusterCount int64) runAllocation {
+    var usage runAllocation
+    end := LCN + clusterCount
+    for cluster := LCN; cluster < end && !(usage.hasAllocated && usage.hasUnallocated); {
+        // Clusters outside of the bitmap don't exist on the volume, so there is nothing to recover either
+        if cluster < 0 {
+            usage.hasAllocated = true
+            cluster = 0
+            continue
+        }
+        if cluster/8 >= int64(len(clusterBitmap)) {
+            usage.hasAllocated = true
+            break
+        }
+        bitmapByte := clusterBitmap[cluster/8]
+        if cluster%8 == 0 && cluster+8 <= end {
+            usage.hasAllocated = usage.hasAllocated || bitmapByte != 0
+            usage.hasUnallocated = usage.hasUnallocated || bitmapByte != 0xFF
+            cluster += 8
+            continue
+        }
+        if bitmapByte&(1<<uint(cluster%8)) != 0 {
+            usage.hasAllocated = true
+        } else {
+            usage.hasUnallocated = true
+        }
+        cluster++
+    }
+    return usage
+}
+
+// Checks the clusters of every deleted file against $Bitmap (one bit per cluster, set = in use), clusters that are still free can be recovered as is
+func UpdateClusterStatus(volumeID int, clusterBitmap []byte) {
+    rows, err := Database.Query(`SELECT d.RID, d.LCN, d.clusterCount FROM dataruns d JOIN files f ON f.volumeID = d.volumeID AND f.RID = d.RID
+        WHERE d.volumeID = ? AND d.stream = '' AND f.isActive = 0 AND d.isSparse = 0`, volumeID)
+    if err != nil {
+        fmt.Println("[!] Failed to load data runs of deleted files:", err)
+        return
+    }
+    clusterUsage := make(map[int]runAllocation)
+    for rows.Next() {
+        var RID int
+        var LCN, clusterCount int64
+        if err := rows.Scan(&RID, &LCN, &clusterCount); err != nil {
+            fmt.Println("[!] Failed to read data run:", err)
+            rows.Close()
+            return
+        }
+        usage := clusterUsage[RID]
+        // Once a file has both, its status is settled and the remaining runs don't have to be looked at
+        if !usage.hasAllocated || !usage.hasUnallocated {
+            runUsage := checkRunAllocation(clusterBitmap, LCN, clusterCount)
+            usage.hasAllocated = usage.hasAllocated || runUsage.hasAllocated
+            usage.hasUnallocated = usage.hasUnallocated || runUsage.hasUnallocated
+        }
+        clusterUsage[RID] = usage
+    }
+    rows.Close()
+
+    Tx, err := Database.Begin()
+    if err != nil {
+        fmt.Println("[!] Failed to begin transaction:", err)
+        return
+    }
+    Stmt, err := Tx.Prepare("UPDATE files SET clusterStatus = ? WHERE volumeID = ? AND RID = ?")
+    if err != nil {
+        fmt.Println("[!] Failed to prepare update statement:", err)
+        return
+    }
+    recoverable := 0
+    for RID, usage := range clusterUsage {
+        status := "partially overwritten"
+        if !usage.hasAllocated {
+            status = "unallocated"
+            recoverable++
+        } else if !usage.hasUnallocated {
+            status = "overwritten"
+        }
+        if _, err := Stmt.Exec(status, volumeID, RID); err != nil {
+            fmt.Printf("[!!] Failed to update RID %d on volume %d: %v\n", RID, volumeID, err)
+        }
+    }
+    Stmt.Close()
+    // Resident data lives in the MFT record itself, it survives as long as the record slot isn't reused
+    if _, err := Tx.Exec("UPDATE files SET clusterStatus = 'resident' WHERE volumeID = ? AND isActive = 0 AND isResident = 1", volumeID); err != nil {
+        fmt.Println("[!] Failed to update resident deleted files:", err)
+    }
+    if _, err := Tx.Exec("UPDATE files SET clusterStatus = 'empty' WHERE volumeID = ? AND isActive = 0 AND fileLength = 0 AND clusterStatus IS NULL", volumeID); err != nil {
+        fmt.Println("[!] Failed to update empty deleted files:", err)
+    }
+    if err = Tx.Commit(); err != nil {
+        fmt.Println("[!] Commit failed:", err)
+        return
+    }
+    fmt.Printf("  --> %d of %d non-resident deleted files still have all of their clusters unallocated\n", recoverable, len(clusterUsage))
+}
+
+// Lists the deleted files, the ones whose content can still be recovered first (volumeID 0 = all volumes)
+func PrintDeletedFiles(volumeID int) bool {
+    rows, err := Database.Query(`SELECT FID, volumeID, RID, COALESCE(fullPath, filename, ''), fileLength, COALESCE(clusterStatus, 'unknown'), isOrphan FROM files
+        WHERE isActive = 0 AND isFolder = 0 AND isCorrupt = 0 AND (? = 0 OR volumeID = ?)
+        ORDER BY CASE clusterStatus WHEN 'unallocated' THEN 0 WHEN 'resident' THEN 1 WHEN 'partially overwritten' THEN 2 ELSE 3 END, volumeID, fullPath`, volumeID, volumeID)
+    if err != nil {
+        fmt.Println("[!] Query failed:", err)
+        return false
+    }
+    defer rows.Close()
+
+    count, recoverable := 0, 0
+    for rows.Next() {
+        var FID, volume, RID, orphan int
+        var fullPath, status string
+        var length int64
+        if err := rows.Scan(&FID, &volume, &RID, &fullPath, &length, &status, &orphan); err != nil {
+            fmt.Println("[!] Failed to read entry:", err)
+            return false
+        }
+        fmt.Printf("[%s] FID %d (volume %d, RID %d), %d bytes: %s\n", status, FID, volume, RID, length, fullPath)
+        count++
+        if status == "unallocated" || status == "resident" {
+            recoverable++
+        }
+    }
+    fmt.Printf("[+] %d deleted files, %d of them recoverable (carve with -carve -fid <FID>)\n", count, recoverable)
+    return true
 }
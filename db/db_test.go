@@ -0,0 +1,144 @@
+package db
+
+import "strings"
+import "testing"
+import "MFS2SQL/internal"
+
+// Every test gets its own in-memory database, the single connection keeps it alive until the test ends
+func setUpTestDB(t *testing.T) internal.VOLUME_INFO {
+    if !SetUpSQLiteDB("file:" + t.Name() + "?mode=memory&cache=shared") {
+        t.Fatal("unable to set up the database")
+    }
+    Database.SetMaxOpenConns(1)
+    t.Cleanup(func() {
+        Database.Close()
+    })
+    volume := internal.VOLUME_INFO{VolumeID: 1, ClusterSize: 4096}
+    InsertVolume(volume)
+    return volume
+}
+
+func insertTestFile(volume internal.VOLUME_INFO, RID uint32, sequence uint16, parentID uint64, parentSequence uint16, name string, isActive bool) {
+    InsertFileRecord(volume, internal.FILE_INFO{RecordID: RID, SequenceNumber: sequence, ParentDirectory: parentID, ParentSequence: parentSequence, FileName: name, IsActive: isActive, IsFolder: true})
+}
+
+func TestUpdateFullpaths(t *testing.T) {
+    volume := setUpTestDB(t)
+    insertTestFile(volume, 5, 5, 5, 5, ".", true)
+    insertTestFile(volume, 30, 1, 5, 5, "Users", true)
+    insertTestFile(volume, 31, 1, 30, 1, "file.txt", true)
+    // The parent record doesn't exist (anymore)
+    insertTestFile(volume, 40, 1, 99, 1, "lost.txt", false)
+    // Only the folder lost its parent, the part of the chain below it is kept
+    insertTestFile(volume, 70, 1, 98, 1, "Folder C", false)
+    insertTestFile(volume, 71, 1, 70, 1, "x.txt", false)
+    // Record 50 was reused by another folder, the stale file still references sequence 1
+    insertTestFile(volume, 50, 3, 5, 5, "Folder B", true)
+    insertTestFile(volume, 51, 1, 50, 1, "stale.txt", false)
+    // Deleting a record increments its sequence number, a deleted parent one ahead is still the same folder
+    insertTestFile(volume, 60, 2, 5, 5, "Deleted", false)
+    insertTestFile(volume, 61, 1, 60, 1, "child.txt", false)
+    FlushBatch()
+    UpdateFullpaths()
+
+    tests := map[int]struct {
+        fullPath string
+        isOrphan bool
+    }{
+        31: {`Users\file.txt`, false},
+        40: {`$OrphanFiles\lost.txt`, true},
+        71: {`$OrphanFiles\Folder C\x.txt`, true},
+        51: {`$OrphanFiles\stale.txt`, true},
+        61: {`Deleted\child.txt`, false},
+    }
+    for RID, want := range tests {
+        var fullPath string
+        var isOrphan bool
+        if err := Database.QueryRow("SELECT fullPath, isOrphan FROM files WHERE RID = ?", RID).Scan(&fullPath, &isOrphan); err != nil {
+            t.Fatal(err)
+        }
+        if fullPath != want.fullPath || isOrphan != want.isOrphan {
+            t.Errorf("RID %d: got %q (orphan %t), want %q (orphan %t)", RID, fullPath, isOrphan, want.fullPath, want.isOrphan)
+        }
+    }
+}
+
+// Two stale records that are each other's parent must not recurse forever, both end up in $OrphanFiles
+func TestUpdateFullpathsParentCycle(t *testing.T) {
+    volume := setUpTestDB(t)
+    insertTestFile(volume, 80, 1, 81, 1, "A", false)
+    insertTestFile(volume, 81, 1, 80, 1, "B", false)
+    FlushBatch()
+    UpdateFullpaths()
+
+    rows, err := Database.Query("SELECT RID, fullPath, isOrphan FROM files")
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer rows.Close()
+    for rows.Next() {
+        var RID int
+        var fullPath string
+        var isOrphan bool
+        if err := rows.Scan(&RID, &fullPath, &isOrphan); err != nil {
+            t.Fatal(err)
+        }
+        if !isOrphan || !strings.HasPrefix(fullPath, OrphanFilesRoot+`\`) || strings.Count(fullPath, `\`) > 2 {
+            t.Errorf("RID %d: got %q (orphan %t)", RID, fullPath, isOrphan)
+        }
+    }
+}
+
+func insertDeletedFile(volume internal.VOLUME_INFO, RID uint32, dataRuns ...internal.DATA_RUN) {
+    InsertFileRecord(volume, internal.FILE_INFO{RecordID: RID, SequenceNumber: 2, ParentDirectory: 5, ParentSequence: 5, FileName: "deleted.bin", DataLength: 4096, DataRuns: dataRuns})
+}
+
+func TestUpdateClusterStatus(t *testing.T) {
+    volume := setUpTestDB(t)
+    // Clusters 0-15 free, 16-31 in use, 40-47 only cluster 44 in use, 48-63 free
+    clusterBitmap := []byte{0x00, 0x00, 0xFF, 0xFF, 0x00, 0x10, 0x00, 0x00}
+    insertDeletedFile(volume, 100, internal.DATA_RUN{LCN: 0, ClusterCount: 16})
+    insertDeletedFile(volume, 101, internal.DATA_RUN{LCN: 16, ClusterCount: 16})
+    // Starts and ends halfway a bitmap byte, the allocated cluster is in a byte that is tested as a whole
+    insertDeletedFile(volume, 102, internal.DATA_RUN{LCN: 35, ClusterCount: 21})
+    // Both runs on their own are uniform, only together they make a partially overwritten file
+    insertDeletedFile(volume, 103, internal.DATA_RUN{LCN: 3, ClusterCount: 2}, internal.DATA_RUN{VCN: 2, LCN: 20, ClusterCount: 1})
+    insertDeletedFile(volume, 104, internal.DATA_RUN{LCN: 1000, ClusterCount: 4})
+    insertDeletedFile(volume, 105, internal.DATA_RUN{LCN: 37, ClusterCount: 7})
+    FlushBatch()
+    UpdateClusterStatus(volume.VolumeID, clusterBitmap)
+
+    want := map[int]string{
+        100: "unallocated",
+        101: "overwritten",
+        102: "partially overwritten",
+        103: "partially overwritten",
+        104: "overwritten",
+        105: "unallocated",
+    }
+    for RID, status := range want {
+        var clusterStatus string
+        if err := Database.QueryRow("SELECT clusterStatus FROM files WHERE RID = ?", RID).Scan(&clusterStatus); err != nil {
+            t.Fatal(err)
+        }
+        if clusterStatus != status {
+            t.Errorf("RID %d: got %q, want %q", RID, clusterStatus, status)
+        }
+    }
+}
+
+// A compression unit other than the 16 clusters Windows writes has to come back from the database as stored
+func TestLoadFileRecordCompressionUnit(t *testing.T) {
+    volume := setUpTestDB(t)
+    dataRuns := []internal.DATA_RUN{{LCN: 100, ClusterCount: 4}}
+    InsertFileRecord(volume, internal.FILE_INFO{RecordID: 42, SequenceNumber: 1, ParentDirectory: 5, ParentSequence: 5, FileName: "compressed.bin", IsActive: true, DataLength: 8192, HasDataRun: true, DataRuns: dataRuns, IsCompressed: true, CompressionUnit: 4,
+        Streams: []internal.STREAM_INFO{{Name: "stream", DataLength: 8192, HasDataRun: true, DataRuns: dataRuns, IsCompressed: true, CompressionUnit: 8}}})
+    FlushBatch()
+
+    for stream, want := range map[string]uint32{"": 4, "stream": 8} {
+        _, fileInformation, ok := LoadFileRecord(1, stream)
+        if !ok || !fileInformation.IsCompressed || fileInformation.CompressionUnit != want {
+            t.Errorf("stream %q: got compressed %t, unit %d, want unit %d", stream, fileInformation.IsCompressed, fileInformation.CompressionUnit, want)
+        }
+    }
+}
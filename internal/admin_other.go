@@ -0,0 +1,10 @@
+//go:build !windows
+
+package internal
+
+import "os"
+
+// On Linux (and other unix-like analysis boxes) raw block devices are only readable by root
+func IsAdmin() bool {
+    return os.Geteuid() == 0
+}
@@ -0,0 +1,23 @@
+//go:build windows
+
+package internal
+
+import "golang.org/x/sys/windows"
+
+// Usability improvement
+func IsAdmin() bool {
+    var sid *windows.SID
+    // SECURITY_NT_AUTHORITY is {0,0,0,0,0,5}
+    ntAuthority := windows.SECURITY_NT_AUTHORITY
+    err := windows.AllocateAndInitializeSid(&ntAuthority, 2,
+        windows.SECURITY_BUILTIN_DOMAIN_RID,
+        windows.DOMAIN_ALIAS_RID_ADMINS,
+        0, 0, 0, 0, 0, 0, &sid)
+    if err != nil {
+        return false
+    }
+
+    token := windows.Token(0)
+    isMember, err := token.IsMember(sid)
+    return err == nil && isMember
+}
@@ -13,7 +13,7 @@ type GPTHEADER struct{
 	FirstLBA uint32
 	LastLBA uint32
 	DiskGUID [16]byte
-	PartitionEntriesLBA uint32
+	PartitionEntriesLBA uint64
 	NumberOfPartitions uint32
 	PartitionEntrySize uint32
 	Crc32PartitionEntry [4]byte
@@ -24,12 +24,31 @@ type PARTITIONENTRY struct{
 	// Based on table from: https://wiki.osdev.org/GPT
 	PartitionGUID [16]byte
 	UniquePartitionGUID [16]byte
-	StartingLBA uint32
-	EndingLBA uint32
+	StartingLBA uint64
+	EndingLBA uint64
 	Attributes [8]byte
 	PartitionName [72]byte
 }
 
+type MBRPARTITIONENTRY struct{
+	// Based on table from: https://wiki.osdev.org/MBR_(x86)
+	BootIndicator uint8
+	StartingCHS [3]byte
+	PartitionType uint8				// 0x07 = NTFS/exFAT, 0x05/0x0F = extended, 0xEE = GPT protective
+	EndingCHS [3]byte
+	StartingLBA uint32				// Relative to the MBR/EBR it is defined in, ParseMBRPartitions makes this absolute
+	NumberOfSectors uint32
+}
+
+type MBRHEADER struct{
+	// Based on table from: https://wiki.osdev.org/MBR_(x86)
+	BootstrapCode [440]byte
+	DiskSignature [4]byte
+	Reserved [2]byte
+	PartitionEntries [4]MBRPARTITIONENTRY
+	BootSignature [2]byte			// Should be 0x55 0xAA
+}
+
 type NTFS_BOOT_PARTITION struct{
 	// Based on informatiom from: https://learn.microsoft.com/en-us/previous-versions/windows/it-pro/windows-2000-server/cc976796(v=technet.10)?redirectedfrom=MSDN
 	Jumpinstruction [3]byte
@@ -47,16 +66,30 @@ type NTFS_BOOT_PARTITION struct{
 	UnusedTwo [4]byte
 	UnusedThree [4]byte				//Start of Extended BPB
 	TotalSectors [8]byte
-	MFTOffset uint32
+	MFTOffset uint64
 	MFTMirrorOffset [8]byte
 	ClusterPerFileRecord [4]byte
 	ClusterPerIndexBlock [4]byte
-	VolumeSerialNumber [8]byte
+	VolumeSerialNumber uint64
 	Checksum [4]byte				// End EBPB
 	BootstrapCode [426]byte
 	EndOfSectionMarker [2]byte
 }
 
+// Every validated NTFS partition becomes a volume, all file records are tagged with its VolumeID
+type VOLUME_INFO struct{
+	VolumeID int
+	PartitionIndex int				// Position in the GPT/MBR partition table (logical MBR partitions follow the primaries)
+	PartitionType string			// GPT partition type GUID or MBR partition type byte
+	PartitionGUID string			// GPT unique partition GUID, empty for MBR partitions
+	NTFSOffset uint64				// Absolute offset of the NTFS boot sector on the disk
+	ClusterSize uint32
+	VolumeSerialNumber uint64
+	StandaloneMFT bool				// Records come from an extracted $MFT file, there is no disk to calculate absolute offsets with
+	MFTBlocks []DATA_RUN			// Runs of the $MFT itself, used to look up records by their number
+	SecurityDescriptors map[uint32]SECURITY_DESCRIPTOR	// Contents of $Secure:$SDS by security ID, empty when it couldn't be read
+}
+
 type MFT_ENTRY struct{
 	// Based on information from: https://flatcap.github.io/linux-ntfs/ntfs/concepts/file_record.html
 	MagicNumber [4]byte
@@ -98,21 +131,111 @@ type DATA_RUN struct{
 	ClusterCountLength int
 	ClusterOffsetLength int
 	ClusterCount int64
+	VCN int64							// Virtual cluster number, the position of the run within the file
+	LCN int64							// Logical cluster number, the position of the run within the volume
+	IsSparse bool						// Not stored on disk, reads as zeros
 	AbsoluteOffsetWithinNTFSPartition int64
 }
 
+// One $FILE_NAME attribute, a record has one per hard link and an extra one for a DOS 8.3 short name
+type FILE_NAME_INFO struct{
+	ParentDirectory uint64		// 48-bit record number of the parent directory
+	ParentSequence uint16		// Sequence number the parent record had when this name was written
+	Namespace uint8			// 0 = POSIX, 1 = Win32, 2 = DOS, 3 = Win32 & DOS
+	Name string
+	CreatedUTCWinFileEpoch uint64
+	ModifiedUTCWinFileEpoch uint64
+	RecordModifiedUTCWinFileEpoch uint64
+	LastReadUTCWinFileEpoch uint64
+}
+
+// One $DATA attribute, the unnamed one is the file content, named ones are alternate data streams (Zone.Identifier, file.txt:payload)
+type STREAM_INFO struct{
+	Name string
+	IsResident bool
+	DataLength uint64
+	HasDataRun bool
+	DataCluster uint64
+	FullDataOffset uint64
+	DataRuns []DATA_RUN
+	ResidentData []byte		// Content of a resident stream, taken from the record after the fixups were applied
+	IsCompressed bool		// LZNT1 compressed in units of CompressionUnit clusters
+	CompressionUnit uint32	// Clusters per compression unit, 2^ the compression unit of the attribute header
+}
+
+// Parsed Zone.Identifier stream, written by browsers and mail clients on downloaded files (Mark of the Web)
+type MARK_OF_THE_WEB struct{
+	ZoneID int				// 0 = local machine, 1 = intranet, 2 = trusted, 3 = internet, 4 = restricted, -1 = not present
+	ReferrerUrl string
+	HostUrl string
+}
+
+// One access control entry, the common layouts (access mask followed by the SID) and the object ACE layout are decoded
+type ACE struct{
+	Type uint8				// 0 = allowed, 1 = denied, 2 = audit, 5/6 = object allowed/denied, 0x11 = mandatory label
+	Flags uint8				// Inheritance: 0x01 object inherit, 0x02 container inherit, 0x04 no propagate, 0x08 inherit only, 0x10 inherited
+	AccessMask uint32
+	SID string
+}
+
+// Self-relative security descriptor from $Secure:$SDS, shared by every file with the same security ID
+type SECURITY_DESCRIPTOR struct{
+	SecurityID uint32
+	Control uint16			// SE_DACL_PRESENT, SE_DACL_PROTECTED, ... flags
+	OwnerSID string
+	GroupSID string
+	DACL []ACE
+	SACL []ACE
+	SDDL string				// The descriptor in Security Descriptor Definition Language, e.g. O:BAG:SYD:PAI(A;;FA;;;SY)
+}
+
+// Decoded $REPARSE_POINT attribute, the tag tells which file system filter handles the file (symbolic link, junction, OneDrive, WOF)
+type REPARSE_POINT struct{
+	Tag uint32
+	TargetPath string		// Substitute name of links and mount points (\??\C:\Users), target of app execution aliases and WSL symlinks
+	PrintName string		// Target as shown to the user (dir, explorer), can be empty for mount points
+	IsRelative bool			// Relative symbolic link, the target starts at the directory holding the link
+}
+
 type FILE_INFO struct{
 	RecordID uint32
 	IsFolder bool
 	IsActive bool
+	IsCorrupt bool			// Torn write (update sequence mismatch) or BAAD record, no attributes were parsed
 	FileName string
-	FileCreatedUTCWinFileEpoch uint32
-	FileModifiedUTCWinFileEpoch uint32
-	FileRecordModifiedUTCWinFileEpoch uint32
-	FileLastReadUTCWinFileEpoch uint32
+	FileCreatedUTCWinFileEpoch uint64		// $STANDARD_INFORMATION times, FILETIME (100ns intervals since 1601-01-01 UTC)
+	FileModifiedUTCWinFileEpoch uint64
+	FileRecordModifiedUTCWinFileEpoch uint64
+	FileLastReadUTCWinFileEpoch uint64
+	FileNameCreatedUTCWinFileEpoch uint64		// $FILE_NAME times, only updated by Windows on create/rename/move, which makes them harder to stomp
+	FileNameModifiedUTCWinFileEpoch uint64
+	FileNameRecordModifiedUTCWinFileEpoch uint64
+	FileNameLastReadUTCWinFileEpoch uint64
 	FilePermissionFlag uint32
 	FileOwnerID uint16
-	ParentDirectory uint32
-	DataLength uint32
+	SecurityID uint32		// Key of the security descriptor in $Secure:$SDS, 0 for NTFS 1.x records (48 byte $STANDARD_INFORMATION)
+	ParentDirectory uint64
+	ParentSequence uint16
+	SequenceNumber uint16	// Incremented every time the record slot is reused, references to this record carry it as well
+	DataLength uint64
+	IsResident bool			// Data is stored inside the MFT record itself
+	HasDataRun bool
+	DataCluster uint64		// Logical cluster number (LCN) of the first data run, relative to the start of the volume
 	FullDataOffset uint64	//This should include the NTFS offset as well!
+	DataRuns []DATA_RUN		// All extents of a non-resident $DATA attribute
+	ResidentData []byte		// Content of a resident $DATA attribute, nil when it wasn't captured
+	IsCompressed bool		// NTFS (LZNT1) compression, the clusters on disk don't hold the plain content
+	CompressionUnit uint32	// Clusters that are compressed together, 16 for every volume written by Windows
+	FileNames []FILE_NAME_INFO	// Every $FILE_NAME attribute, FileName and ParentDirectory hold the best display name of these
+	Streams []STREAM_INFO		// Named $DATA attributes (alternate data streams), the unnamed $DATA is kept in the fields above
+	HasMarkOfTheWeb bool
+	MarkOfTheWeb MARK_OF_THE_WEB
+	BaseRecord uint64		// Set in extension records, the record number of the base record that owns their attributes
+	BaseSequence uint16
+	HasAttributeList bool	// Attributes that didn't fit are stored in extension records, listed by the $ATTRIBUTE_LIST
+	AttributeList STREAM_INFO
+	HasReparsePoint bool
+	ReparsePoint REPARSE_POINT
+	IsWofCompressed bool	// Windows Overlay Filter (CompactOS), the unnamed $DATA is sparse and the content is in the WofCompressedData stream
+	WofAlgorithm uint32		// 0 = XPRESS4K, 1 = LZX, 2 = XPRESS8K, 3 = XPRESS16K
 }
\ No newline at end of file
@@ -1,30 +1,22 @@
 package internal
 
-import "golang.org/x/sys/windows"
 import "fmt"
+import "encoding/binary"
 import "strconv"
 import "strings"
-
-// Usability improvement
-func IsAdmin() bool {
-    var sid *windows.SID
-    // SECURITY_NT_AUTHORITY is {0,0,0,0,0,5}
-    ntAuthority := windows.SECURITY_NT_AUTHORITY
-    err := windows.AllocateAndInitializeSid(&ntAuthority, 2,
-        windows.SECURITY_BUILTIN_DOMAIN_RID,
-        windows.DOMAIN_ALIAS_RID_ADMINS,
-        0, 0, 0, 0, 0, 0, &sid)
-    if err != nil {
-        return false
-    }
-
-    token := windows.Token(0)
-    isMember, err := token.IsMember(sid)
-    return err == nil && isMember
-}
+import "time"
+import "unicode/utf16"
 
 // General supporting
 // *** Supporting functions
+// Raw devices (\\.\physicaldrive0, /dev/sda) need elevated privileges, image files don't
+func IsPhysicalDevice(location string) bool{
+	if(strings.HasPrefix(location, `\\.\`) || strings.HasPrefix(location, "/dev/")){
+		return true
+	}
+	return false
+}
+
 func BoolToInt(value bool) int{
 	var returnValue = 0
 	if(value){
@@ -36,6 +28,189 @@ func BoolToInt(value bool) int{
 	return returnValue
 }
 
+// FILETIME counts 100ns intervals since 1601-01-01 UTC, all 7 decimals are kept as timestomping tools tend to zero them.
+// Seconds and nanoseconds are split before converting, a time.Duration would overflow beyond the year 2262.
+func FiletimeToISO8601(filetime uint64) string{
+	const secondsFrom1601To1970 = 11644473600
+	if(filetime == 0){
+		return ""
+	}
+	seconds := int64(filetime / 10000000) - secondsFrom1601To1970
+	nanoseconds := int64(filetime % 10000000) * 100
+	return time.Unix(seconds, nanoseconds).UTC().Format("2006-01-02T15:04:05.0000000Z")
+}
+
+// NTFS stores names as UTF-16LE, surrogate pairs are combined and unpaired surrogates become U+FFFD, so the result is always valid UTF-8
+func DecodeUTF16LE(buffer []byte) string{
+	codeUnits := make([]uint16, len(buffer)/2)
+	for i := range codeUnits{
+		codeUnits[i] = binary.LittleEndian.Uint16(buffer[i*2:])
+	}
+	return string(utf16.Decode(codeUnits))
+}
+
+// Namespace names as used by Windows (and most forensic tooling)
+func NamespaceToString(namespace uint8) string{
+	switch namespace{
+	case 0:
+		return "POSIX"
+	case 1:
+		return "Win32"
+	case 2:
+		return "DOS"
+	case 3:
+		return "Win32&DOS"
+	}
+	return fmt.Sprintf("unknown (%d)", namespace)
+}
+
+// URL security zones as used in the ZoneId of a Zone.Identifier stream
+func ZoneIDToString(zoneID int) string{
+	switch zoneID{
+	case 0:
+		return "Local machine"
+	case 1:
+		return "Local intranet"
+	case 2:
+		return "Trusted sites"
+	case 3:
+		return "Internet"
+	case 4:
+		return "Restricted sites"
+	}
+	return fmt.Sprintf("unknown (%d)", zoneID)
+}
+
+// Reparse tags that are decoded or commonly found on Windows volumes: https://learn.microsoft.com/en-us/openspecs/windows_protocols/ms-fscc/c8e77b37-3909-4fe6-a4ea-2b9d423b1ee4
+const (
+	ReparseTagMountPoint = 0xA0000003		// Directory junction or volume mount point
+	ReparseTagSymlink = 0xA000000C
+	ReparseTagWof = 0x80000017
+	ReparseTagAppExecLink = 0x8000001B		// App execution alias (WindowsApps\*.exe)
+	ReparseTagLxSymlink = 0xA000001D		// Symbolic link created inside WSL
+)
+
+func ReparseTagToString(tag uint32) string{
+	switch tag{
+	case ReparseTagMountPoint:
+		return "Mount point"
+	case ReparseTagSymlink:
+		return "Symbolic link"
+	case ReparseTagWof:
+		return "WOF compressed"
+	case ReparseTagAppExecLink:
+		return "App execution alias"
+	case ReparseTagLxSymlink:
+		return "WSL symbolic link"
+	case 0x80000013:
+		return "Deduplicated"
+	case 0x80000021:
+		return "OneDrive"
+	case 0x8000001E:
+		return "Azure File Sync"
+	case 0x9000001C:
+		return "Projected file system"
+	case 0x80000023:
+		return "Unix socket"
+	case 0x80000014:
+		return "NFS"
+	case 0x8000000A:
+		return "DFS"
+	case 0x80000012:
+		return "DFS replication"
+	case 0xC0000004:
+		return "HSM"
+	}
+	// Cloud Files (OneDrive Files On-Demand placeholders) use 0x9000001A, with the provider specific variant in bits 12-15
+	if(tag & 0xFFFF0FFF == 0x9000001A){
+		return "Cloud placeholder"
+	}
+	return fmt.Sprintf("unknown (0x%08X)", tag)
+}
+
+// Junctions and volume mount points share a tag, a volume mount point targets the volume GUID path (\??\Volume{...}\)
+func ReparsePointToString(reparsePoint REPARSE_POINT) string{
+	if(reparsePoint.Tag == ReparseTagMountPoint){
+		if(strings.HasPrefix(reparsePoint.TargetPath, `\??\Volume{`)){
+			return "Volume mount point"
+		}
+		return "Junction"
+	}
+	return ReparseTagToString(reparsePoint.Tag)
+}
+
+// Compression algorithms of the Windows Overlay Filter, indexed by the algorithm number in its reparse data
+var WofAlgorithms = []string{"XPRESS4K", "LZX", "XPRESS8K", "XPRESS16K"}
+
+func WofAlgorithmToString(algorithm uint32) string{
+	if(int(algorithm) < len(WofAlgorithms)){
+		return WofAlgorithms[algorithm]
+	}
+	return fmt.Sprintf("unknown (%d)", algorithm)
+}
+
+// Well-known SIDs with their SDDL alias and account name: https://learn.microsoft.com/en-us/windows/win32/secauthz/sid-strings
+var wellKnownSIDs = map[string][2]string{
+	"S-1-1-0": {"WD", "Everyone"},
+	"S-1-3-0": {"CO", "CREATOR OWNER"},
+	"S-1-3-1": {"CG", "CREATOR GROUP"},
+	"S-1-3-4": {"OW", "OWNER RIGHTS"},
+	"S-1-5-2": {"NU", "NETWORK"},
+	"S-1-5-4": {"IU", "INTERACTIVE"},
+	"S-1-5-6": {"SU", "SERVICE"},
+	"S-1-5-7": {"AN", "ANONYMOUS LOGON"},
+	"S-1-5-10": {"PS", "SELF"},
+	"S-1-5-11": {"AU", "Authenticated Users"},
+	"S-1-5-12": {"RC", "RESTRICTED"},
+	"S-1-5-18": {"SY", "SYSTEM"},
+	"S-1-5-19": {"LS", "LOCAL SERVICE"},
+	"S-1-5-20": {"NS", "NETWORK SERVICE"},
+	"S-1-5-32-544": {"BA", "Administrators"},
+	"S-1-5-32-545": {"BU", "Users"},
+	"S-1-5-32-546": {"BG", "Guests"},
+	"S-1-5-32-547": {"PU", "Power Users"},
+	"S-1-5-32-551": {"BO", "Backup Operators"},
+	"S-1-15-2-1": {"AC", "ALL APPLICATION PACKAGES"},
+	"S-1-16-4096": {"LW", "Low Mandatory Level"},
+	"S-1-16-8192": {"ME", "Medium Mandatory Level"},
+	"S-1-16-12288": {"HI", "High Mandatory Level"},
+	"S-1-16-16384": {"SI", "System Mandatory Level"},
+}
+
+// The two letter SDDL alias of a well-known SID, the SID itself otherwise
+func SIDToSDDLAlias(sid string) string{
+	if wellKnownSID, ok := wellKnownSIDs[sid]; ok{
+		return wellKnownSID[0]
+	}
+	return sid
+}
+
+// The account name of a well-known SID, the SID itself otherwise (domain accounts can't be resolved offline)
+func SIDToName(sid string) string{
+	if wellKnownSID, ok := wellKnownSIDs[sid]; ok{
+		return wellKnownSID[1]
+	}
+	return sid
+}
+
+// A file reference holds the record number in the lower 48 bits and the sequence number in the upper 16 bits
+func SplitFileReference(reference uint64) (uint64, uint16){
+	return reference & 0xFFFFFFFFFFFF, uint16(reference >> 48)
+}
+
+// GUIDs are stored mixed-endian: the first three groups little endian, the last two as is
+func FormatGUID(guid [16]byte) string{
+	if(IsEmptyBuffer(guid[:])){
+		return ""
+	}
+	return fmt.Sprintf("%08x-%04x-%04x-%x-%x",
+		binary.LittleEndian.Uint32(guid[0:4]),
+		binary.LittleEndian.Uint16(guid[4:6]),
+		binary.LittleEndian.Uint16(guid[6:8]),
+		guid[8:10],
+		guid[10:16])
+}
+
 func IsEmptyBuffer(s []byte) bool {
     for _, v := range s {
         if v != 0 {
@@ -45,57 +220,25 @@ func IsEmptyBuffer(s []byte) bool {
     return true
 }
 
-// Magic :)
-
-func CalculateHexComplement(input string) (string){
-	returnString := ""
-	oppositesMap := make(map[string]string)
-	oppositesMap["0"] = "f"
-	oppositesMap["1"] = "e"
-	oppositesMap["2"] = "d"
-	oppositesMap["3"] = "c"
-	oppositesMap["4"] = "b"
-	oppositesMap["5"] = "a"
-	oppositesMap["6"] = "9"
-	oppositesMap["7"] = "8"
-	oppositesMap["8"] = "7"
-	oppositesMap["9"] = "6"
-	oppositesMap["a"] = "5"
-	oppositesMap["b"] = "4"
-	oppositesMap["c"] = "3"
-	oppositesMap["d"] = "2"
-	oppositesMap["e"] = "1"
-	oppositesMap["f"] = "0"
-	
-	for counter, _ := range input{
-		returnString = returnString + oppositesMap[string(input[counter])]
-	}
-	return returnString
-}
-
-func ConvertClusterOffsetHexFromDatarunToDecimalOffset(offsetLength int, buffer []byte, offsetToMFTBlockOffsetInHex int) (int64){
-	var returnOffset int64
-	var offsetAsString string
-	
-	if((offsetLength) > 3){
-				// If the first byte starts with a zero, we need to remove that zero, and add it to the end of the byte
-				offsetAsString = offsetAsString + fmt.Sprintf("%x",buffer[offsetToMFTBlockOffsetInHex+3:offsetToMFTBlockOffsetInHex+4][0])
-	}
-	offsetAsString = offsetAsString + fmt.Sprintf("%x",buffer[offsetToMFTBlockOffsetInHex+2:offsetToMFTBlockOffsetInHex+3])
-	offsetAsString = offsetAsString + fmt.Sprintf("%x",buffer[offsetToMFTBlockOffsetInHex+1:offsetToMFTBlockOffsetInHex+2])
-	offsetAsString = offsetAsString + fmt.Sprintf("%x",buffer[offsetToMFTBlockOffsetInHex:offsetToMFTBlockOffsetInHex+1])
-	offsetAsString = offsetAsString + "000"
-	returnOffset,_ = strconv.ParseInt(offsetAsString, 16, 64)
-	
-	// Checking if the hex value represents a signed integer: https://www.d.umn.edu/~gshute/asm/signed.xhtml / https://github.com/libyal/libfsntfs/blob/main/documentation/New%20Technologies%20File%20System%20(NTFS).asciidoc
-	// 1. get MSB of first Hex value, 2. (if signed, > 7, calculate the complement and add 1, transpose to decimal and add minus symbol)
-	if( offsetAsString[0] > 64){
-		// Calculate offset Complement
-		complementHex := CalculateHexComplement(offsetAsString)
-		returnOffset,_ = strconv.ParseInt(complementHex, 16, 64)
-		returnOffset = (-1)*(returnOffset+1)
-	}
-	return returnOffset
+// Data runs store their numbers in as few bytes as possible, little endian
+func ReadLittleEndianUnsigned(input []byte) uint64{
+	var returnNumber uint64
+	for index := len(input) - 1; index >= 0; index-- {
+		returnNumber = returnNumber<<8 | uint64(input[index])
+	}
+	return returnNumber
+}
+
+// Same as above, but the most significant bit of the last byte is the sign (two's complement)
+func ReadLittleEndianSigned(input []byte) int64{
+	if(len(input) == 0){
+		return 0
+	}
+	returnNumber := int64(ReadLittleEndianUnsigned(input))
+	if(input[len(input)-1] >= 128 && len(input) < 8){
+		returnNumber = returnNumber - (int64(1) << (8 * uint(len(input))))
+	}
+	return returnNumber
 }
 
 func ParseNimble(nimble uint8) (int, int) {
@@ -104,13 +247,3 @@ func ParseNimble(nimble uint8) (int, int) {
     clusterCountLength, _ := strconv.Atoi(string(hexStr[1]))
     return clusterCountLength, clusterOffsetLength
 }
-
-
-func ParseNimble_old(nimble uint8) (int, int){
-	var clusterCountLength int
-	var clusterOffsetLength int
-	slidedHexStringNimble := strings.Split(strconv.FormatInt(int64(nimble), 16),"")
-	clusterCountLength,_ = strconv.Atoi(slidedHexStringNimble[1])
-	clusterOffsetLength,_ = strconv.Atoi(slidedHexStringNimble[0])
-	return clusterCountLength, clusterOffsetLength
-}
@@ -20,6 +20,7 @@ func ShowBannerAndIntro() {
 It allows you to directly access files, including their length and location on the physical disk.
 Before using the tool, make sure to set-up the database: MSF2SQL -dumpMode 2
 Please note, that the tool requires administrator priviledges for accessing \\.\
+Acquired disk images (.dd/.raw/.img) can be analysed without those priviledges: MSF2SQL -imageFile disk.dd -dumpMode 2
 `
     fmt.Println(banner)
     fmt.Println(intro)
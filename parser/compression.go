@@ -0,0 +1,652 @@
+package parser
+
+import "encoding/binary"
+import "errors"
+import "fmt"
+import "io"
+import "os"
+import "MFS2SQL/internal"
+
+// Rebuilds an NTFS compressed file from its run list, one compression unit (compressionUnitClusters clusters, taken from the attribute header) at a time.
+// A unit is either stored as is (all clusters allocated), LZNT1 compressed (followed by sparse clusters) or completely sparse.
+func ReadCompressedDataRuns(driveLocation string, dataRuns []internal.DATA_RUN, NTFSOffset uint64, clusterSize uint32, compressionUnitClusters int64, realSize uint64, output io.Writer) (uint64, error){
+	var bytesWritten uint64
+	if(compressionUnitClusters <= 0){
+		return 0, fmt.Errorf("invalid compression unit of %d clusters", compressionUnitClusters)
+	}
+	handle, err := os.Open(driveLocation)
+	if(err != nil){
+		return 0, err
+	}
+	defer handle.Close()
+
+	unitSize := compressionUnitClusters * int64(clusterSize)
+	runIndex := 0
+	for unitVCN := int64(0); bytesWritten < realSize; unitVCN = unitVCN + compressionUnitClusters{
+		// The runs are in VCN order, skip the ones that end before this unit
+		for(runIndex < len(dataRuns) && dataRuns[runIndex].VCN + dataRuns[runIndex].ClusterCount <= unitVCN){
+			runIndex++
+		}
+		var unitData []byte
+		for _, dataRun := range dataRuns[runIndex:]{
+			if(dataRun.VCN >= unitVCN + compressionUnitClusters){
+				break
+			}
+			if(dataRun.IsSparse){
+				continue
+			}
+			firstVCN := dataRun.VCN
+			if(firstVCN < unitVCN){
+				firstVCN = unitVCN
+			}
+			lastVCN := dataRun.VCN + dataRun.ClusterCount
+			if(lastVCN > unitVCN + compressionUnitClusters){
+				lastVCN = unitVCN + compressionUnitClusters
+			}
+			chunk := make([]byte, (lastVCN - firstVCN)*int64(clusterSize))
+			handle.Seek(int64(NTFSOffset) + (dataRun.LCN + firstVCN - dataRun.VCN)*int64(clusterSize), 0)
+			if _, err := io.ReadFull(handle, chunk); err != nil{
+				return bytesWritten, err
+			}
+			unitData = append(unitData, chunk...)
+		}
+
+		var decompressed []byte
+		switch{
+		case len(unitData) == 0:
+			decompressed = make([]byte, unitSize)
+		case int64(len(unitData)) == unitSize:
+			decompressed = unitData
+		default:
+			decompressed, err = DecompressLZNT1(unitData, int(unitSize))
+			if(err != nil){
+				return bytesWritten, fmt.Errorf("compression unit at VCN %d: %w", unitVCN, err)
+			}
+			// A unit that compressed well can still be a full unit of data, the remainder reads as zeros
+			if(int64(len(decompressed)) < unitSize){
+				decompressed = append(decompressed, make([]byte, unitSize - int64(len(decompressed)))...)
+			}
+		}
+
+		if(bytesWritten + uint64(len(decompressed)) > realSize){
+			decompressed = decompressed[:realSize - bytesWritten]
+		}
+		if _, err := output.Write(decompressed); err != nil{
+			return bytesWritten, err
+		}
+		bytesWritten = bytesWritten + uint64(len(decompressed))
+	}
+	return bytesWritten, nil
+}
+
+// LZNT1 as used by NTFS compression: https://learn.microsoft.com/en-us/openspecs/windows_protocols/ms-xca/5655f4a3-6ba4-489b-959f-e1f407c52f15
+// The input is a sequence of chunks of at most 4096 decompressed bytes, each with a 16-bit header (bit 15 = compressed, low 12 bits = size - 1).
+func DecompressLZNT1(compressed []byte, maxSize int) ([]byte, error){
+	const chunkSize = 4096
+	output := make([]byte, 0, maxSize)
+	offset := 0
+	for(offset + 2 <= len(compressed) && len(output) < maxSize){
+		header := binary.LittleEndian.Uint16(compressed[offset:offset + 2])
+		if(header == 0){
+			break
+		}
+		chunkLength := int(header & 0x0FFF) + 1
+		offset = offset + 2
+		if(offset + chunkLength > len(compressed)){
+			return output, errors.New("LZNT1 chunk runs past the end of the input")
+		}
+		chunk := compressed[offset:offset + chunkLength]
+		offset = offset + chunkLength
+
+		// Every chunk but the last one holds exactly 4096 bytes, a short one is padded with zeros
+		if(len(output) % chunkSize != 0){
+			output = append(output, make([]byte, chunkSize - len(output) % chunkSize)...)
+		}
+		if(header & 0x8000 == 0){
+			output = append(output, chunk...)
+			continue
+		}
+
+		chunkStart := len(output)
+		for position := 0; position < len(chunk); {
+			// A flag byte tells for the next 8 tokens whether they are a literal byte (0) or a back reference (1)
+			flags := chunk[position]
+			position++
+			for bit := uint(0); bit < 8 && position < len(chunk); bit++{
+				if(flags & (1 << bit) == 0){
+					output = append(output, chunk[position])
+					position++
+					continue
+				}
+				if(position + 2 > len(chunk)){
+					return output, errors.New("LZNT1 back reference runs past the end of the chunk")
+				}
+				token := binary.LittleEndian.Uint16(chunk[position:position + 2])
+				position = position + 2
+				// The split between offset and length bits depends on how far into the chunk we are
+				lengthMask := uint16(0x0FFF)
+				displacementShift := uint(12)
+				for chunkPosition := len(output) - chunkStart - 1; chunkPosition >= 0x10; chunkPosition >>= 1{
+					lengthMask >>= 1
+					displacementShift--
+				}
+				length := int(token & lengthMask) + 3
+				displacement := int(token >> displacementShift) + 1
+				if(displacement > len(output) - chunkStart){
+					return output, errors.New("LZNT1 back reference points before the start of the chunk")
+				}
+				// Byte by byte, the reference can overlap with the bytes it produces
+				for copied := 0; copied < length; copied++{
+					output = append(output, output[len(output) - displacement])
+				}
+			}
+		}
+	}
+	if(len(output) > maxSize){
+		output = output[:maxSize]
+	}
+	return output, nil
+}
+
+// WOF (Windows Overlay Filter, used by CompactOS and compact /exe) stores the file in the WofCompressedData stream:
+// a table with the offset of every chunk but the first, followed by the independently compressed chunks.
+// A chunk that didn't compress is stored as is. https://github.com/ebiggers/ntfs-3g-system-compression
+func DecompressWof(compressedData []byte, uncompressedSize uint64, algorithm uint32, output io.Writer) (uint64, error){
+	chunkSize, ok := wofChunkSizes[algorithm]
+	if(!ok){
+		return 0, fmt.Errorf("unknown WOF compression algorithm %d", algorithm)
+	}
+	var bytesWritten uint64
+	numberOfChunks := (uncompressedSize + chunkSize - 1) / chunkSize
+	if(numberOfChunks == 0){
+		return 0, nil
+	}
+	// Files over 4GB need 64-bit offsets
+	entrySize := uint64(4)
+	if(uncompressedSize > 0xFFFFFFFF){
+		entrySize = 8
+	}
+	chunkTableSize := (numberOfChunks - 1) * entrySize
+	if(chunkTableSize > uint64(len(compressedData))){
+		return 0, errors.New("WOF chunk table runs past the end of the WofCompressedData stream")
+	}
+	chunkOffset := func(chunk uint64) uint64{
+		if(chunk == 0){
+			return chunkTableSize
+		}
+		if(chunk == numberOfChunks){
+			return uint64(len(compressedData))
+		}
+		entry := compressedData[(chunk - 1)*entrySize:chunk*entrySize]
+		if(entrySize == 8){
+			return chunkTableSize + binary.LittleEndian.Uint64(entry)
+		}
+		return chunkTableSize + uint64(binary.LittleEndian.Uint32(entry))
+	}
+
+	for chunk := uint64(0); chunk < numberOfChunks; chunk++{
+		chunkStart, chunkEnd := chunkOffset(chunk), chunkOffset(chunk + 1)
+		if(chunkStart > chunkEnd || chunkEnd > uint64(len(compressedData))){
+			return bytesWritten, fmt.Errorf("WOF chunk %d lies outside of the WofCompressedData stream", chunk)
+		}
+		chunkData := compressedData[chunkStart:chunkEnd]
+		chunkLength := chunkSize
+		if(uncompressedSize - bytesWritten < chunkLength){
+			chunkLength = uncompressedSize - bytesWritten
+		}
+
+		decompressed := chunkData
+		if(uint64(len(chunkData)) != chunkLength){
+			var err error
+			if(algorithm == wofAlgorithmLZX){
+				decompressed, err = DecompressLZX(chunkData, int(chunkLength))
+			} else{
+				decompressed, err = DecompressXpressHuffman(chunkData, int(chunkLength))
+			}
+			if(err != nil){
+				return bytesWritten, fmt.Errorf("WOF chunk %d: %w", chunk, err)
+			}
+		}
+		if _, err := output.Write(decompressed); err != nil{
+			return bytesWritten, err
+		}
+		bytesWritten = bytesWritten + uint64(len(decompressed))
+	}
+	return bytesWritten, nil
+}
+
+// FILE_PROVIDER_COMPRESSION_* values from the WOF reparse point, every algorithm has its own chunk size
+const wofAlgorithmLZX = 1
+
+var wofChunkSizes = map[uint32]uint64{0: 4096, 1: 32768, 2: 8192, 3: 16384}
+
+// Canonical Huffman code as used by XPRESS and LZX: shorter codes come first, codes of the same length are ordered by symbol value
+type huffmanCode struct{
+	counts [17]int			// Number of codes of every length
+	symbols []uint16		// Symbols ordered by code length, then symbol value
+}
+
+func newHuffmanCode(codeLengths []uint8) (huffmanCode, error){
+	var code huffmanCode
+	for _, codeLength := range codeLengths{
+		if(codeLength > 16){
+			return code, errors.New("Huffman code length over 16 bits")
+		}
+		code.counts[codeLength]++
+	}
+	code.counts[0] = 0
+	// More codes of a length than the code space allows can't be decoded
+	available := 1
+	for length := 1; length <= 16; length++{
+		available = available*2 - code.counts[length]
+		if(available < 0){
+			return code, errors.New("Huffman code is over-subscribed")
+		}
+	}
+	for length := uint8(1); length <= 16; length++{
+		for symbol, codeLength := range codeLengths{
+			if(codeLength == length){
+				code.symbols = append(code.symbols, uint16(symbol))
+			}
+		}
+	}
+	return code, nil
+}
+
+// Decodes one symbol from the next bits (most significant bit first), returns the symbol and its code length
+func (code *huffmanCode) decode(bits uint32, width uint) (uint16, uint, bool){
+	codeValue, first, index := 0, 0, 0
+	for length := uint(1); length <= width && length <= 16; length++{
+		codeValue = codeValue | int((bits >> (width - length)) & 1)
+		count := code.counts[length]
+		if(codeValue - first < count){
+			return code.symbols[index + codeValue - first], length, true
+		}
+		index = index + count
+		first = (first + count) << 1
+		codeValue = codeValue << 1
+	}
+	return 0, 0, false
+}
+
+// LZ77+Huffman (XPRESS Huffman): https://learn.microsoft.com/en-us/openspecs/windows_protocols/ms-xca/a8b7cb0a-92a6-4187-a23b-5e14273b96f8
+// The input starts with 512 4-bit code lengths (256 literals, 256 match symbols), followed by a bitstream of 16-bit little endian words.
+// Extra match length bytes are stored in between the words, at the position the decoder has read up to.
+func DecompressXpressHuffman(compressed []byte, outputSize int) ([]byte, error){
+	output := make([]byte, 0, outputSize)
+	inputPosition := 0
+	read16 := func(position int) uint32{
+		if(position + 2 > len(compressed)){
+			return 0
+		}
+		return uint32(binary.LittleEndian.Uint16(compressed[position:position + 2]))
+	}
+
+	for(len(output) < outputSize){
+		// Every 64KB of output starts with a new code
+		if(inputPosition + 256 > len(compressed)){
+			return output, errors.New("XPRESS Huffman table runs past the end of the input")
+		}
+		codeLengths := make([]uint8, 512)
+		for i := 0; i < 256; i++{
+			codeLengths[2*i] = compressed[inputPosition + i] & 0x0F
+			codeLengths[2*i + 1] = compressed[inputPosition + i] >> 4
+		}
+		code, err := newHuffmanCode(codeLengths)
+		if(err != nil){
+			return output, err
+		}
+		currentPosition := inputPosition + 256
+		nextBits := read16(currentPosition) << 16 | read16(currentPosition + 2)
+		currentPosition = currentPosition + 4
+		extraBitCount := 16
+		consumeBits := func(bitLength uint){
+			nextBits = nextBits << bitLength
+			extraBitCount = extraBitCount - int(bitLength)
+			if(extraBitCount < 0){
+				nextBits = nextBits + read16(currentPosition) << uint(-extraBitCount)
+				extraBitCount = extraBitCount + 16
+				currentPosition = currentPosition + 2
+			}
+		}
+
+		blockEnd := len(output) + 65536
+		for(len(output) < blockEnd && len(output) < outputSize){
+			symbol, codeLength, ok := code.decode(nextBits >> 17, 15)
+			if(!ok){
+				return output, errors.New("invalid XPRESS Huffman code")
+			}
+			consumeBits(codeLength)
+			if(symbol < 256){
+				output = append(output, byte(symbol))
+				continue
+			}
+
+			symbol = symbol - 256
+			matchLength := int(symbol & 0x0F)
+			offsetBitLength := uint(symbol >> 4)
+			if(matchLength == 15){
+				if(currentPosition >= len(compressed)){
+					return output, errors.New("XPRESS Huffman match length runs past the end of the input")
+				}
+				matchLength = int(compressed[currentPosition])
+				currentPosition++
+				if(matchLength == 255){
+					if(currentPosition + 2 > len(compressed)){
+						return output, errors.New("XPRESS Huffman match length runs past the end of the input")
+					}
+					matchLength = int(binary.LittleEndian.Uint16(compressed[currentPosition:currentPosition + 2]))
+					currentPosition = currentPosition + 2
+					if(matchLength == 0){
+						if(currentPosition + 4 > len(compressed)){
+							return output, errors.New("XPRESS Huffman match length runs past the end of the input")
+						}
+						matchLength = int(binary.LittleEndian.Uint32(compressed[currentPosition:currentPosition + 4]))
+						currentPosition = currentPosition + 4
+					}
+					if(matchLength < 15){
+						return output, errors.New("invalid XPRESS Huffman match length")
+					}
+					matchLength = matchLength - 15
+				}
+				matchLength = matchLength + 15
+			}
+			matchLength = matchLength + 3
+
+			matchOffset := 1 << offsetBitLength
+			if(offsetBitLength > 0){
+				matchOffset = matchOffset + int(nextBits >> (32 - offsetBitLength))
+			}
+			consumeBits(offsetBitLength)
+			if(matchOffset > len(output)){
+				return output, errors.New("XPRESS Huffman match points before the start of the output")
+			}
+			for copied := 0; copied < matchLength && len(output) < outputSize; copied++{
+				output = append(output, output[len(output) - matchOffset])
+			}
+		}
+		inputPosition = currentPosition
+	}
+	return output, nil
+}
+
+// LZX as used by WIM and WOF: a 32KB window, every chunk starts with empty code lengths and recent offsets of 1.
+// The bitstream is made of 16-bit little endian words, read most significant bit first.
+type lzxBitReader struct{
+	data []byte
+	position int
+	buffer uint64			// Unread bits, aligned to the most significant bit
+	count uint
+}
+
+func (reader *lzxBitReader) ensure(bits uint){
+	for(reader.count < bits){
+		var word uint64
+		// Reading past the end yields zeros, the output size tells when to stop
+		if(reader.position + 2 <= len(reader.data)){
+			word = uint64(binary.LittleEndian.Uint16(reader.data[reader.position:reader.position + 2]))
+		}
+		reader.position = reader.position + 2
+		reader.buffer = reader.buffer | word << (48 - reader.count)
+		reader.count = reader.count + 16
+	}
+}
+
+func (reader *lzxBitReader) read(bits uint) uint32{
+	if(bits == 0){
+		return 0
+	}
+	reader.ensure(bits)
+	value := uint32(reader.buffer >> (64 - bits))
+	reader.buffer = reader.buffer << bits
+	reader.count = reader.count - bits
+	return value
+}
+
+func (reader *lzxBitReader) readSymbol(code *huffmanCode) (uint16, error){
+	reader.ensure(16)
+	symbol, codeLength, ok := code.decode(uint32(reader.buffer >> 48), 16)
+	if(!ok){
+		return 0, errors.New("invalid LZX Huffman code")
+	}
+	reader.read(codeLength)
+	return symbol, nil
+}
+
+// Uncompressed blocks continue as a byte stream on the next 16-bit boundary, an aligned stream skips a full word
+func (reader *lzxBitReader) align(){
+	if(reader.count % 16 == 0){
+		reader.read(16)
+	} else{
+		reader.read(reader.count % 16)
+	}
+	// Words that were read ahead belong to the byte stream
+	reader.position = reader.position - int(reader.count / 16) * 2
+	reader.buffer = 0
+	reader.count = 0
+}
+
+func (reader *lzxBitReader) readBytes(length int) ([]byte, error){
+	if(reader.position + length > len(reader.data)){
+		return nil, errors.New("LZX uncompressed block runs past the end of the input")
+	}
+	value := reader.data[reader.position:reader.position + length]
+	reader.position = reader.position + length
+	return value, nil
+}
+
+// Code lengths are sent as the difference with the lengths of the previous block, coded with a 20 symbol pretree
+func (reader *lzxBitReader) readCodeLengths(codeLengths []uint8) error{
+	pretreeLengths := make([]uint8, 20)
+	for i := range pretreeLengths{
+		pretreeLengths[i] = uint8(reader.read(4))
+	}
+	pretree, err := newHuffmanCode(pretreeLengths)
+	if(err != nil){
+		return err
+	}
+	for i := 0; i < len(codeLengths); {
+		symbol, err := reader.readSymbol(&pretree)
+		if(err != nil){
+			return err
+		}
+		// Symbols 0-16 are deltas to the previous length, 17 and 18 are runs of zeros and 19 a short run of one delta.
+		// The delta is applied to the length at the start of the run, every length in the run gets that same value.
+		runLength := 1
+		value := uint8(0)
+		switch{
+		case symbol == 17:
+			runLength = 4 + int(reader.read(4))
+		case symbol == 18:
+			runLength = 20 + int(reader.read(5))
+		case symbol == 19:
+			runLength = 4 + int(reader.read(1))
+			if symbol, err = reader.readSymbol(&pretree); err != nil{
+				return err
+			}
+			// 17 as a delta keeps the previous length, (length - 17 + 17) % 17
+			if(symbol > 17){
+				return errors.New("invalid LZX pretree symbol")
+			}
+			value = uint8((int(codeLengths[i]) - int(symbol) + 17) % 17)
+		default:
+			value = uint8((int(codeLengths[i]) - int(symbol) + 17) % 17)
+		}
+		for ; runLength > 0 && i < len(codeLengths); runLength--{
+			codeLengths[i] = value
+			i++
+		}
+	}
+	return nil
+}
+
+func DecompressLZX(compressed []byte, outputSize int) ([]byte, error){
+	const (
+		numberOfChars = 256
+		numberOfOffsetSlots = 30		// For a 32KB window
+		numberOfMainSymbols = numberOfChars + numberOfOffsetSlots*8
+		numberOfLengthSymbols = 249
+		minimumAlignedOffsetSlot = 8
+	)
+	// Offset slot n covers offsets from its base up to the base of the next slot
+	var offsetSlotBase [numberOfOffsetSlots]uint32
+	var offsetSlotExtraBits [numberOfOffsetSlots]uint
+	for slot := 0; slot < numberOfOffsetSlots; slot++{
+		if(slot >= 4){
+			offsetSlotExtraBits[slot] = uint(slot / 2 - 1)
+		}
+		if(slot > 0){
+			offsetSlotBase[slot] = offsetSlotBase[slot - 1] + 1 << offsetSlotExtraBits[slot - 1]
+		}
+	}
+
+	reader := lzxBitReader{data: compressed}
+	output := make([]byte, 0, outputSize)
+	mainLengths := make([]uint8, numberOfMainSymbols)
+	lengthLengths := make([]uint8, numberOfLengthSymbols)
+	recentOffsets := [3]uint32{1, 1, 1}
+
+	for(len(output) < outputSize){
+		reader.ensure(4)
+		blockType := reader.read(3)
+		blockSize := 32768
+		if(reader.read(1) == 0){
+			blockSize = int(reader.read(16))
+		}
+		blockEnd := len(output) + blockSize
+		if(blockEnd > outputSize){
+			blockEnd = outputSize
+		}
+
+		if(blockType == 3){
+			// Uncompressed block, the recent offsets are stored in front of the raw bytes
+			reader.ensure(1)
+			reader.align()
+			for i := range recentOffsets{
+				value, err := reader.readBytes(4)
+				if(err != nil){
+					return output, err
+				}
+				recentOffsets[i] = binary.LittleEndian.Uint32(value)
+			}
+			rawData, err := reader.readBytes(blockEnd - len(output))
+			if(err != nil){
+				return output, err
+			}
+			output = append(output, rawData...)
+			if(blockSize % 2 == 1){
+				reader.position++
+			}
+			continue
+		}
+		if(blockType != 1 && blockType != 2){
+			return output, fmt.Errorf("invalid LZX block type %d", blockType)
+		}
+
+		// Aligned offset blocks code the lowest 3 bits of large offsets separately
+		var alignedCode huffmanCode
+		alignedFromSlot := numberOfOffsetSlots
+		if(blockType == 2){
+			alignedLengths := make([]uint8, 8)
+			for i := range alignedLengths{
+				alignedLengths[i] = uint8(reader.read(3))
+			}
+			var err error
+			if alignedCode, err = newHuffmanCode(alignedLengths); err != nil{
+				return output, err
+			}
+			alignedFromSlot = minimumAlignedOffsetSlot
+		}
+		if err := reader.readCodeLengths(mainLengths[:numberOfChars]); err != nil{
+			return output, err
+		}
+		if err := reader.readCodeLengths(mainLengths[numberOfChars:]); err != nil{
+			return output, err
+		}
+		if err := reader.readCodeLengths(lengthLengths); err != nil{
+			return output, err
+		}
+		mainCode, err := newHuffmanCode(mainLengths)
+		if(err != nil){
+			return output, err
+		}
+		lengthCode, err := newHuffmanCode(lengthLengths)
+		if(err != nil){
+			return output, err
+		}
+
+		for(len(output) < blockEnd){
+			symbol, err := reader.readSymbol(&mainCode)
+			if(err != nil){
+				return output, err
+			}
+			if(symbol < numberOfChars){
+				output = append(output, byte(symbol))
+				continue
+			}
+
+			symbol = symbol - numberOfChars
+			matchLength := int(symbol % 8)
+			offsetSlot := int(symbol / 8)
+			if(matchLength == 7){
+				lengthSymbol, err := reader.readSymbol(&lengthCode)
+				if(err != nil){
+					return output, err
+				}
+				matchLength = matchLength + int(lengthSymbol)
+			}
+			matchLength = matchLength + 2
+
+			var matchOffset uint32
+			if(offsetSlot < 3){
+				// Repeat one of the three most recent offsets
+				matchOffset = recentOffsets[offsetSlot]
+				recentOffsets[offsetSlot] = recentOffsets[0]
+				recentOffsets[0] = matchOffset
+			} else{
+				matchOffset = offsetSlotBase[offsetSlot]
+				extraBits := offsetSlotExtraBits[offsetSlot]
+				if(offsetSlot >= alignedFromSlot){
+					matchOffset = matchOffset + reader.read(extraBits - 3) << 3
+					alignedSymbol, err := reader.readSymbol(&alignedCode)
+					if(err != nil){
+						return output, err
+					}
+					matchOffset = matchOffset + uint32(alignedSymbol)
+				} else{
+					matchOffset = matchOffset + reader.read(extraBits)
+				}
+				matchOffset = matchOffset - 2
+				recentOffsets[2] = recentOffsets[1]
+				recentOffsets[1] = recentOffsets[0]
+				recentOffsets[0] = matchOffset
+			}
+			if(matchOffset == 0 || int(matchOffset) > len(output)){
+				return output, errors.New("LZX match points before the start of the output")
+			}
+			for copied := 0; copied < matchLength && len(output) < blockEnd; copied++{
+				output = append(output, output[len(output) - int(matchOffset)])
+			}
+		}
+	}
+	undoLZXE8Translation(output)
+	return output, nil
+}
+
+// The compressor turns the relative targets of x86 CALL instructions (0xE8) into absolute ones, with a fixed file size of 12000000
+func undoLZXE8Translation(data []byte){
+	const translationSize = 12000000
+	for position := 0; position + 10 < len(data); {
+		if(data[position] != 0xE8){
+			position++
+			continue
+		}
+		absoluteOffset := int32(binary.LittleEndian.Uint32(data[position + 1:position + 5]))
+		if(absoluteOffset >= 0 && absoluteOffset < translationSize){
+			binary.LittleEndian.PutUint32(data[position + 1:position + 5], uint32(absoluteOffset - int32(position)))
+		} else if(absoluteOffset < 0 && absoluteOffset >= -int32(position)){
+			binary.LittleEndian.PutUint32(data[position + 1:position + 5], uint32(absoluteOffset + translationSize))
+		}
+		position = position + 5
+	}
+}
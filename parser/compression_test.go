@@ -0,0 +1,189 @@
+package parser
+
+import "bytes"
+import "encoding/binary"
+import "encoding/hex"
+import "os"
+import "path/filepath"
+import "strings"
+import "testing"
+import "MFS2SQL/internal"
+
+// "0123456789ABCDEF" as 16 literals, then a back reference at position 16 (4 bit displacement, 12 bit length: 16 bytes back, 16 long)
+// and one at position 32, past the first split change (5 bit displacement, 11 bit length: 32 bytes back, 10 long)
+var compressedLZNT1Chunk = []byte{
+	0x16, 0xB0,
+	0x00, '0', '1', '2', '3', '4', '5', '6', '7',
+	0x00, '8', '9', 'A', 'B', 'C', 'D', 'E', 'F',
+	0x03, 0x0D, 0xF0, 0x07, 0xF8,
+}
+var decompressedLZNT1Chunk = []byte("0123456789ABCDEF0123456789ABCDEF0123456789")
+
+func TestDecompressLZNT1UncompressedChunk(t *testing.T){
+	compressed := append([]byte{0x04, 0x30}, "plain"...)
+	decompressed, err := DecompressLZNT1(compressed, 4096)
+	if(err != nil || string(decompressed) != "plain"){
+		t.Fatalf("got %q, %v", decompressed, err)
+	}
+}
+
+func TestDecompressLZNT1BackReferences(t *testing.T){
+	decompressed, err := DecompressLZNT1(compressedLZNT1Chunk, 4096)
+	if(err != nil || !bytes.Equal(decompressed, decompressedLZNT1Chunk)){
+		t.Fatalf("got %q, %v", decompressed, err)
+	}
+}
+
+func TestDecompressLZNT1PadsShortChunk(t *testing.T){
+	// A chunk that isn't the last one always stands for 4096 bytes, the bytes it doesn't produce are zeros
+	compressed := append(append([]byte(nil), compressedLZNT1Chunk...), 0x02, 0x30, 'e', 'n', 'd')
+	decompressed, err := DecompressLZNT1(compressed, 8192)
+	if(err != nil || len(decompressed) != 4096 + 3){
+		t.Fatalf("got %d bytes, %v", len(decompressed), err)
+	}
+	if(!bytes.Equal(decompressed[:len(decompressedLZNT1Chunk)], decompressedLZNT1Chunk) || string(decompressed[4096:]) != "end"){
+		t.Fatal("chunks not at their 4096 byte boundaries")
+	}
+	if(bytes.Count(decompressed[len(decompressedLZNT1Chunk):4096], []byte{0}) != 4096 - len(decompressedLZNT1Chunk)){
+		t.Fatal("padding isn't zero")
+	}
+}
+
+// Compression units of 4 clusters of 1024 bytes: a compressed unit, a sparse unit and a stored unit cut off by the real size.
+// With the usual 16 clusters per unit these runs would be read as a single unit.
+func TestReadCompressedDataRunsUnits(t *testing.T){
+	const clusterSize = 1024
+	disk := make([]byte, 6*clusterSize)
+	for i := range disk[:clusterSize]{
+		disk[i] = 0xEE
+	}
+	copy(disk[clusterSize:], compressedLZNT1Chunk)
+	for i := range disk[2*clusterSize:]{
+		disk[2*clusterSize + i] = byte(i)
+	}
+	driveLocation := filepath.Join(t.TempDir(), "disk.img")
+	if err := os.WriteFile(driveLocation, disk, 0644); err != nil{
+		t.Fatal(err)
+	}
+	dataRuns := []internal.DATA_RUN{
+		{VCN: 0, LCN: 1, ClusterCount: 1},
+		{VCN: 1, ClusterCount: 7, IsSparse: true},
+		{VCN: 8, LCN: 2, ClusterCount: 4},
+	}
+	const realSize = 8*clusterSize + 100
+	var output bytes.Buffer
+	bytesWritten, err := ReadCompressedDataRuns(driveLocation, dataRuns, 0, clusterSize, 4, realSize, &output)
+	if(err != nil || bytesWritten != realSize || output.Len() != realSize){
+		t.Fatalf("got %d bytes, %v", bytesWritten, err)
+	}
+	want := make([]byte, realSize)
+	copy(want, decompressedLZNT1Chunk)
+	copy(want[8*clusterSize:], disk[2*clusterSize:2*clusterSize + 100])
+	if(!bytes.Equal(output.Bytes(), want)){
+		t.Fatal("units not decompressed in 4 cluster steps")
+	}
+	if _, err := ReadCompressedDataRuns(driveLocation, dataRuns, 0, clusterSize, 0, realSize, &output); err == nil{
+		t.Fatal("a compression unit of 0 clusters was accepted")
+	}
+}
+
+// Test vectors made with a reference encoder, the compressed streams are written as hex
+func decodeHexVector(t *testing.T, lines ...string) []byte{
+	t.Helper()
+	data, err := hex.DecodeString(strings.Join(lines, ""))
+	if(err != nil){
+		t.Fatal(err)
+	}
+	return data
+}
+
+// Two verbatim blocks that only hold literals, the first codes 'A'-'P' with 4 bits and the second 'C'-'b' with 5 bits.
+// The second main tree is written with runs of symbol 19, e.g. over 'M'-'Q' whose previous lengths are 4, 4, 4, 4, 0:
+// every length in the run becomes 4 - 16 + 17 = 5, the delta isn't applied to each previous length on its own.
+func TestDecompressLZXMultipleBlocks(t *testing.T){
+	compressed := decodeHexVector(t,
+		"0220448444444444554555557f5ffeb5cf7fcff9efbffefb221222222222aa22",
+		"aaaabfaffbeffffe88a088888888aa88aaaaefabfefbbfff83ece1f2c7d0a5b6",
+		"8394e1f2c7d0a5b68394e1f290d00202222222222222aaaaafaadcbf9ffffef3",
+		"8f7ffef18f31df7ffaf7880888888888aa8aaaaaffbeefbffefb228222222222",
+		"aa22aaaabfaffbeffffe05b22cd89bb8bb817e240d8b3c9aba3cf989fa3405aa",
+		"2cd89bb8bb817e240d8b3c9aba3cf989fa3400aa0000")
+	var want []byte
+	for i := 0; i < 40; i++{
+		want = append(want, "ABCDEFGHIJKLMNOP"[i*7 % 16])
+	}
+	for i := 0; i < 64; i++{
+		want = append(want, byte(0x43 + (i*11) % 32))
+	}
+	decompressed, err := DecompressLZX(compressed, len(want))
+	if(err != nil || !bytes.Equal(decompressed, want)){
+		t.Fatalf("got %q, %v", decompressed, err)
+	}
+}
+
+// An uncompressed block of odd size (padded to 16 bits) followed by an aligned offset block with matches 20 and 26 bytes back
+func TestDecompressLZXUncompressedAndAlignedBlocks(t *testing.T){
+	compressed := decodeHexVector(t,
+		"02600030010000000100000001000000756e636f6d7072657373656420626c6f",
+		"636b207769746820616e206f64642073697a65000440db26b46d444444444544",
+		"55555f552067e71fc639e9318fffeff1fefb22da22222222aa22aaaa5fafff1e",
+		"1d537b3cfffed3bf44444444444455555555f3ebff9eefbffefb9160b3a232c2",
+		"2b9de36bdf3ac13ca0df0000")
+	want := "uncompressed block with an odd size" + strings.Repeat("0123456789abcdefghij", 2) + "------0123456789abcdefghij"
+	decompressed, err := DecompressLZX(compressed, len(want))
+	if(err != nil || string(decompressed) != want){
+		t.Fatalf("got %q, %v", decompressed, err)
+	}
+}
+
+// Two CALL instructions, their relative targets (+0x40 and -9) were turned into absolute ones (0x44 and 3) by the compressor
+func TestDecompressLZXE8Translation(t *testing.T){
+	compressed := decodeHexVector(t,
+		"012044d44444444455455555005ddf6b6becafbb037c0c3dd9fb32f41900a2ef",
+		"222222222a22aaaa86aa397b73f3fbeffffe88a288888888aa88aaaa01aa7bce",
+		"fffeefbfaefad0327602f5cf00c00000")
+	want := []byte{0x55, 0x8B, 0xEC, 0xE8, 0x40, 0x00, 0x00, 0x00, 0x90, 0x90, 0x90, 0x90, 0xE8, 0xF7, 0xFF, 0xFF, 0xFF}
+	want = append(want, bytes.Repeat([]byte{0xC3}, 12)...)
+	decompressed, err := DecompressLZX(compressed, len(want))
+	if(err != nil || !bytes.Equal(decompressed, want)){
+		t.Fatalf("got %x, %v", decompressed, err)
+	}
+}
+
+// The code lengths of the reference encoder: 8 bits for literals 0-127, 9 bits for 128-255 and 10 bits for the match symbols
+func xpressCodeLengthTable() []byte{
+	table := bytes.Repeat([]byte{0x88}, 64)
+	table = append(table, bytes.Repeat([]byte{0x99}, 64)...)
+	return append(table, bytes.Repeat([]byte{0xAA}, 128)...)
+}
+
+// A match of 30 bytes (length in one extra byte) and one of 399 bytes (extra byte 255 followed by the 16-bit length)
+const xpressExtendedLengthVector = "31303332353437363938d3cf1ed60c0000ff8c010000"
+var xpressExtendedLengthPlain = strings.Repeat("0123456789", 4) + strings.Repeat("z", 400)
+
+func TestDecompressXpressHuffmanExtendedLength(t *testing.T){
+	compressed := append(xpressCodeLengthTable(), decodeHexVector(t, xpressExtendedLengthVector)...)
+	decompressed, err := DecompressXpressHuffman(compressed, len(xpressExtendedLengthPlain))
+	if(err != nil || string(decompressed) != xpressExtendedLengthPlain){
+		t.Fatalf("got %q, %v", decompressed, err)
+	}
+}
+
+// XPRESS4K: the first chunk didn't compress and is stored as is (its size in the chunk table equals the chunk size), the last one is compressed
+func TestDecompressWofStoredChunk(t *testing.T){
+	storedChunk := make([]byte, 4096)
+	for i := range storedChunk{
+		storedChunk[i] = byte(i*7 ^ i >> 5)
+	}
+	compressedData := binary.LittleEndian.AppendUint32(nil, uint32(len(storedChunk)))
+	compressedData = append(compressedData, storedChunk...)
+	compressedData = append(compressedData, xpressCodeLengthTable()...)
+	compressedData = append(compressedData, decodeHexVector(t, xpressExtendedLengthVector)...)
+	want := append(append([]byte(nil), storedChunk...), xpressExtendedLengthPlain...)
+
+	var output bytes.Buffer
+	bytesWritten, err := DecompressWof(compressedData, uint64(len(want)), 0, &output)
+	if(err != nil || bytesWritten != uint64(len(want)) || !bytes.Equal(output.Bytes(), want)){
+		t.Fatalf("got %d bytes, %v", bytesWritten, err)
+	}
+}
@@ -4,8 +4,11 @@ import "bytes"
 import "encoding/binary"
 import "fmt"
 import "MFS2SQL/internal"
-import "strconv"
 import "os"
+import "io"
+import "sort"
+import "strconv"
+import "strings"
 
 func interPreteMFTRecordFlag(flag uint16)(bool,bool){
 	// https://flatcap.github.io/linux-ntfs/ntfs/concepts/file_record.html
@@ -31,58 +34,72 @@ func interPreteMFTRecordFlag(flag uint16)(bool,bool){
 }
 
 
-func getNumber(input []byte) int64{
-	var returnNumber int64
-	var offsetAsString string
-	
-	if(len(input) > 4){
-		fmt.Println("Error: out of range")
-	}
-	if(len(input) == 4){
-		offsetAsString = offsetAsString + fmt.Sprintf("%x",input[3])
-		offsetAsString = offsetAsString + fmt.Sprintf("%x",input[2])
-		offsetAsString = offsetAsString + fmt.Sprintf("%x",input[1])
-		offsetAsString = offsetAsString + fmt.Sprintf("%x",input[0])		
-	}
-	if(len(input) == 3){
-		offsetAsString = offsetAsString + fmt.Sprintf("%x",input[2])
-		offsetAsString = offsetAsString + fmt.Sprintf("%x",input[1])
-		offsetAsString = offsetAsString + fmt.Sprintf("%x",input[0])		
-	}
-	
-	if(len(input)==2){
-		offsetAsString = offsetAsString + fmt.Sprintf("%x",input[1])
-		offsetAsString = offsetAsString + fmt.Sprintf("%x",input[0])			
-	}
-	
-	if(len(input)==1){
-		offsetAsString = offsetAsString + fmt.Sprintf("%x",input[0])			
-	}
-	returnNumber,_ = strconv.ParseInt(offsetAsString, 16, 64)
-	return returnNumber
+// The name is stored as UTF-16LE right after the fixed part of $FILE_NAME, its length is counted in UTF-16 code units
+func getFilenameAsString(fileNameLength uint8, offset uint16, attribute []byte)(string){	
+	start := offset + 66
+	stop := start + uint16(fileNameLength)*2
+	return internal.DecodeUTF16LE(attribute[start:stop])
 }
 
+// Multi sector records (FILE records and INDX index buffers) protect themselves against torn writes with an update sequence array (USA):
+// the last two bytes of every 512 byte stride are replaced on disk by the update sequence number, the original bytes are kept in the array.
+// https://flatcap.github.io/linux-ntfs/ntfs/concepts/fixup.html
+// Returns false (and leaves the buffer untouched) if a stride doesn't end with the update sequence number, e.g. the record is torn/corrupt.
+func ApplyFixups(recordBuffer []byte) bool{
+	const fixupStride = 512
+	var offsetToUpdate uint16
+	var sizeInWordsOfUpdateSequence uint16
 
-func getFilenameAsString(fileNameLength uint8, offset uint8, attribute []byte)(string){	
-	fileName := ""
-	fileNameLength2 := fileNameLength*2
-	start := offset + 66
-	stop := uint16(start) + uint16(fileNameLength2)
-	fileNameWithZeros := attribute[start:stop]
-				
-	for _, character := range fileNameWithZeros{
-		if character != 0{
-			fileName = fileName + string(character)
+	if(len(recordBuffer) < 8){
+		return false
+	}
+	binary.Read(bytes.NewBuffer(recordBuffer[4:6]), binary.LittleEndian, &offsetToUpdate)
+	binary.Read(bytes.NewBuffer(recordBuffer[6:8]), binary.LittleEndian, &sizeInWordsOfUpdateSequence)
+
+	// The first word is the update sequence number itself, followed by one word per stride
+	strides := int(sizeInWordsOfUpdateSequence) - 1
+	updateSequenceEnd := int(offsetToUpdate) + int(sizeInWordsOfUpdateSequence)*2
+	if(strides < 1 || updateSequenceEnd > len(recordBuffer) || strides*fixupStride > len(recordBuffer)){
+		return false
+	}
+	updateSequenceNumber := recordBuffer[offsetToUpdate:offsetToUpdate+2]
+
+	// Validate all strides first, so a torn record isn't half restored
+	for stride := 1; stride <= strides; stride++ {
+		strideEnd := stride*fixupStride
+		if(!bytes.Equal(recordBuffer[strideEnd-2:strideEnd], updateSequenceNumber)){
+			return false
 		}
 	}
-	return fileName
+	for stride := 1; stride <= strides; stride++ {
+		strideEnd := stride*fixupStride
+		arrayEntry := int(offsetToUpdate) + stride*2
+		copy(recordBuffer[strideEnd-2:strideEnd], recordBuffer[arrayEntry:arrayEntry+2])
+	}
+	return true
 }
 
-func ParseMFTRecord(recordBuffer []byte, recordOffset int64, NTFSOffset uint32, clusterSize uint32, outputMode int) internal.FILE_INFO{
+func ParseMFTRecord(recordBuffer []byte, recordOffset int64, NTFSOffset uint64, clusterSize uint32, outputMode int) (fileInformation internal.FILE_INFO){
 	fileIndicator := [4]byte{70, 73, 76, 69}	// The numbers correspond to the FILE characters
+	badIndicator := [4]byte{66, 65, 65, 68}		// BAAD, written by chkdsk when a multi sector transfer failed
 	var tmpMagicNumber [4]byte
+	// Now that every record slot is visited, stale and half overwritten records come by as well.
+	// Lengths and offsets inside them can point anywhere, they are checked before use and the record is marked as corrupt when they don't fit.
+	if(len(recordBuffer) < 48){
+		fileInformation.IsCorrupt = true
+		return fileInformation
+	}
 	binary.Read(bytes.NewBuffer(recordBuffer[0:4]), binary.LittleEndian, &tmpMagicNumber)
-	var fileInformation internal.FILE_INFO
+
+	// Torn or corrupt records are reported as such, instead of parsing garbage out of them
+	if(tmpMagicNumber == badIndicator || (tmpMagicNumber == fileIndicator && !ApplyFixups(recordBuffer))){
+		binary.Read(bytes.NewBuffer(recordBuffer[44:48]), binary.LittleEndian, &fileInformation.RecordID)
+		fileInformation.IsCorrupt = true
+		if(outputMode == 1){
+			fmt.Printf("Corrupt record (fixup mismatch or BAAD) at offset: %d\n", recordOffset)
+		}
+		return fileInformation
+	}
 	
 	if(tmpMagicNumber == fileIndicator){
 		
@@ -98,6 +115,11 @@ func ParseMFTRecord(recordBuffer []byte, recordOffset int64, NTFSOffset uint32,
 		binary.Read(bytes.NewBuffer(recordBuffer[22:24]), binary.LittleEndian, &fileRecordFlag)
 		binary.Read(bytes.NewBuffer(recordBuffer[24:28]), binary.LittleEndian, &sizeOfRecord)
 		binary.Read(bytes.NewBuffer(recordBuffer[44:48]), binary.LittleEndian, &fileInformation.RecordID)
+		binary.Read(bytes.NewBuffer(recordBuffer[16:18]), binary.LittleEndian, &fileInformation.SequenceNumber)
+		// Only set in extension records, a base record references itself as 0
+		var baseReference uint64
+		binary.Read(bytes.NewBuffer(recordBuffer[32:40]), binary.LittleEndian, &baseReference)
+		fileInformation.BaseRecord, fileInformation.BaseSequence = internal.SplitFileReference(baseReference)
 
 		fileInformation.IsFolder, fileInformation.IsActive = interPreteMFTRecordFlag(fileRecordFlag)
 
@@ -105,93 +127,577 @@ func ParseMFTRecord(recordBuffer []byte, recordOffset int64, NTFSOffset uint32,
 		for(checkEndMarker != endMarker){
 			var attributeType uint16
 			var attributeLength uint16
+			if(int(offsetToAttribute) + 8 > len(recordBuffer)){
+				fileInformation.IsCorrupt = true
+				break
+			}
 			binary.Read(bytes.NewBuffer(recordBuffer[offsetToAttribute:offsetToAttribute +4]), binary.LittleEndian, &attributeType)
 			binary.Read(bytes.NewBuffer(recordBuffer[offsetToAttribute+4:offsetToAttribute +8]), binary.LittleEndian, &attributeLength)
 			// If there are no attributes, you will read FFFF or 65535 as attribute type (which is the end marker)
 			if(attributeType != 65535){
+				// A zero length would loop forever, a too large one points outside of the record
+				if(attributeLength < 8 || int(offsetToAttribute) + int(attributeLength) > len(recordBuffer)){
+					fileInformation.IsCorrupt = true
+					break
+				}
 				// Check for our attributes, we want $DATA (0x80 or 128) and $FILE_NAME (0x30 or 48)
 				// Full list for anybody that wants to complete this implementation: https://learn.microsoft.com/en-us/windows/win32/devnotes/attribute-list-entry
 				attribute := recordBuffer[offsetToAttribute:(offsetToAttribute + attributeLength)]
+				if(!isAttributeHeaderValid(attribute)){
+					fileInformation.IsCorrupt = true
+					break
+				}
 				// attribute 0x10 contains the Standard information, which is kept up to date: https://flatcap.github.io/linux-ntfs/ntfs/attributes/file_name.html
 				if(attributeType == 16){
-					var ofssetToAttributeData uint8		
+					var ofssetToAttributeData uint16
+					var standardInformationLength uint32
 					binary.Read(bytes.NewBuffer(attribute[20:22]), binary.LittleEndian, &ofssetToAttributeData)
+					binary.Read(bytes.NewBuffer(attribute[16:20]), binary.LittleEndian, &standardInformationLength)
+					// NTFS 1.x has a 48 byte attribute. The attribute is always resident, a non-resident header has no value offset to read from
+					// and slicing past the length of the attribute would still succeed as long as it stays within the record buffer.
+					if(attribute[8] != 0 || standardInformationLength < 48 || int(ofssetToAttributeData) + int(standardInformationLength) > len(attribute)){
+						fileInformation.IsCorrupt = true
+						break
+					}
 				
-					// To do: implement time conversaion: https://pkg.go.dev/google.golang.org/protobuf/types/known/timestamppb
+					// The four times are full 64-bit FILETIMEs, converting them to dates is left to the output (see internal.FiletimeToISO8601)
 					binary.Read(bytes.NewBuffer(attribute[ofssetToAttributeData:ofssetToAttributeData + 8]), binary.LittleEndian, &fileInformation.FileCreatedUTCWinFileEpoch)
 					binary.Read(bytes.NewBuffer(attribute[ofssetToAttributeData + 8:ofssetToAttributeData + 16]), binary.LittleEndian, &fileInformation.FileModifiedUTCWinFileEpoch)
 					binary.Read(bytes.NewBuffer(attribute[ofssetToAttributeData + 16:ofssetToAttributeData + 24]), binary.LittleEndian, &fileInformation.FileRecordModifiedUTCWinFileEpoch)
 					binary.Read(bytes.NewBuffer(attribute[ofssetToAttributeData + 24:ofssetToAttributeData + 32]), binary.LittleEndian, &fileInformation.FileLastReadUTCWinFileEpoch)
 				
-					// To do: write parser for flag to optimize DB queriying for insecure permission combinations
+					// The file attribute flags (read-only, hidden, system, ...), the permissions are in the security descriptor the security ID points to
 					binary.Read(bytes.NewBuffer(attribute[ofssetToAttributeData + 32:ofssetToAttributeData + 40]), binary.LittleEndian, &fileInformation.FilePermissionFlag)
-					binary.Read(bytes.NewBuffer(attribute[ofssetToAttributeData + 48:ofssetToAttributeData + 52]), binary.LittleEndian, &fileInformation.FileOwnerID)
+					// Owner and security ID were added in NTFS 3.0 (Windows 2000), older records have a 48 byte attribute and their own $SECURITY_DESCRIPTOR
+					if(standardInformationLength >= 72){
+						binary.Read(bytes.NewBuffer(attribute[ofssetToAttributeData + 48:ofssetToAttributeData + 52]), binary.LittleEndian, &fileInformation.FileOwnerID)
+						binary.Read(bytes.NewBuffer(attribute[ofssetToAttributeData + 52:ofssetToAttributeData + 56]), binary.LittleEndian, &fileInformation.SecurityID)
+					}
 				}
 			
+				// attribute 0x20 lists every attribute of the file and the record holding it, when they don't all fit in the base record
+				if(attributeType == 32){
+					fileInformation.AttributeList = parseDataAttribute(attribute, offsetToAttribute, recordOffset, NTFSOffset, clusterSize, outputMode)
+					fileInformation.HasAttributeList = true
+				}
+
 				// attribute 0x30 contains the information attribute, including the filename
 				if(attributeType == 48){
-					var ofssetToAttributeData uint8		
+					var ofssetToAttributeData uint16
+					var fileNameAttributeLength uint32
 					var fileNameLength uint8		
+					var fileName internal.FILE_NAME_INFO
 				
 					binary.Read(bytes.NewBuffer(attribute[20:22]), binary.LittleEndian, &ofssetToAttributeData)
-					binary.Read(bytes.NewBuffer(attribute[ofssetToAttributeData:ofssetToAttributeData + 6]), binary.LittleEndian, &fileInformation.ParentDirectory)
+					binary.Read(bytes.NewBuffer(attribute[16:20]), binary.LittleEndian, &fileNameAttributeLength)
+					// Always resident as well. The name (UTF-16LE) follows the 66 byte fixed part, both have to fit in the value and the value in the attribute.
+					if(attribute[8] != 0 || fileNameAttributeLength < 66 || int(ofssetToAttributeData) + int(fileNameAttributeLength) > len(attribute)){
+						fileInformation.IsCorrupt = true
+						break
+					}
+					if(66 + uint32(attribute[ofssetToAttributeData + 64])*2 > fileNameAttributeLength){
+						fileInformation.IsCorrupt = true
+						break
+					}
+					// The parent is a file reference: 48-bit record number followed by the 16-bit sequence number of that record
+					var parentReference uint64
+					binary.Read(bytes.NewBuffer(attribute[ofssetToAttributeData:ofssetToAttributeData + 8]), binary.LittleEndian, &parentReference)
+					fileName.ParentDirectory, fileName.ParentSequence = internal.SplitFileReference(parentReference)
+					// Same layout as the times in $STANDARD_INFORMATION, stored right after the parent reference
+					binary.Read(bytes.NewBuffer(attribute[ofssetToAttributeData + 8:ofssetToAttributeData + 16]), binary.LittleEndian, &fileName.CreatedUTCWinFileEpoch)
+					binary.Read(bytes.NewBuffer(attribute[ofssetToAttributeData + 16:ofssetToAttributeData + 24]), binary.LittleEndian, &fileName.ModifiedUTCWinFileEpoch)
+					binary.Read(bytes.NewBuffer(attribute[ofssetToAttributeData + 24:ofssetToAttributeData + 32]), binary.LittleEndian, &fileName.RecordModifiedUTCWinFileEpoch)
+					binary.Read(bytes.NewBuffer(attribute[ofssetToAttributeData + 32:ofssetToAttributeData + 40]), binary.LittleEndian, &fileName.LastReadUTCWinFileEpoch)
 					binary.Read(bytes.NewBuffer(attribute[ofssetToAttributeData +64:ofssetToAttributeData + 65]), binary.LittleEndian, &fileNameLength)
-					fileInformation.FileName = getFilenameAsString(fileNameLength, ofssetToAttributeData, attribute)
+					binary.Read(bytes.NewBuffer(attribute[ofssetToAttributeData +65:ofssetToAttributeData + 66]), binary.LittleEndian, &fileName.Namespace)
+					fileName.Name = getFilenameAsString(fileNameLength, ofssetToAttributeData, attribute)
+					fileInformation.FileNames = append(fileInformation.FileNames, fileName)
 				}
 			
 				// attribute 0x80 contains the data offset, more information about the data attributes: https://sabercomlogica.com/en/ntfs-non-resident-and-no-named-attributes/
 				if(attributeType == 128){
-					// Some limitations, a file record can have multiple $DATA sections. Additionally, a non-resident data record, can have multiple data runs.
-					var noneResidentFlag uint8
-					var ofssetToAttributeData uint16
-					binary.Read(bytes.NewBuffer(attribute[8:9]), binary.LittleEndian, &noneResidentFlag)
-
-					// Data in file record
-					if noneResidentFlag == 0{
-						binary.Read(bytes.NewBuffer(attribute[16:20]), binary.LittleEndian, &fileInformation.DataLength)
-						binary.Read(bytes.NewBuffer(attribute[20:22]), binary.LittleEndian, &ofssetToAttributeData)
-						// To do calculate this back, to get absolute offset (note that the record offset, also includes the NTFS offset)
-						fileInformation.FullDataOffset = uint64(offsetToAttribute) + uint64(ofssetToAttributeData) + uint64(recordOffset)
-					}
-				
-					// Data outside
-					if noneResidentFlag == 1{
-						binary.Read(bytes.NewBuffer(attribute[48:56]), binary.LittleEndian, &fileInformation.DataLength)
-						binary.Read(bytes.NewBuffer(attribute[32:34]), binary.LittleEndian, &ofssetToAttributeData)
-						// Bold move, i'm not going to care for large files with multiple data runs, if you need those, make your own implementation :)
-						// To save space, the dataRun varies in space, the only thing we know for sure is that the length is the first byte: http://inform.pucp.edu.pe/~inf232/Ntfs/ntfs_doc_v0.5/concepts/data_runs.html
-						// In some exceptional cases $REPAIR file, a data offset is specified, however, the datarun is empty as repair might not be configured
-						// To deal with this, check if ofssetToAttributeData doesn't overflow the attribute array, in case it does, lets ignore this.
-					
-						if (int(ofssetToAttributeData) + 1) >= len(attribute){
-							fmt.Println("Exceptional case where $DATA is empty, ignoring this entry")
-						}	
-					
-						if (int(ofssetToAttributeData) + 1) < len(attribute){
-							var dataRun internal.DATA_RUN
-							binary.Read(bytes.NewBuffer(attribute[ofssetToAttributeData:ofssetToAttributeData+1]), binary.LittleEndian, &dataRun.Nimble)
-							// Weird exception case, where there is no data at all or we encounter a sparce / compressed data run
-							// A nimble should have 2 values and shoulnd't be 0, hence comparing if larger than 9
-							if(dataRun.Nimble >= 9){
-								dataRun.ClusterCountLength, dataRun.ClusterOffsetLength = internal.ParseNimble(dataRun.Nimble)
-	
-								tmpStartOffset := ofssetToAttributeData+1+ uint16(dataRun.ClusterCountLength)
-								tmpStopOffset := ofssetToAttributeData+1+uint16(dataRun.ClusterCountLength)+uint16(dataRun.ClusterOffsetLength)
-								fileInformation.FullDataOffset =  uint64(NTFSOffset) + (uint64(clusterSize) * uint64(getNumber(attribute[tmpStartOffset:tmpStopOffset])))
-							}
+					// A file record can have multiple $DATA attributes, only the unnamed one is the file content
+					dataStream := parseDataAttribute(attribute, offsetToAttribute, recordOffset, NTFSOffset, clusterSize, outputMode)
+					if(dataStream.Name == ""){
+						mainStream := getMainStream(fileInformation)
+						mergeStreamExtent(&mainStream, dataStream)
+						setMainStream(&fileInformation, mainStream)
+					} else{
+						fileInformation.Streams = addStreamExtent(fileInformation.Streams, dataStream)
+						// Mark of the Web, only a few hundred bytes so it is practically always resident
+						if(dataStream.Name == "Zone.Identifier" && dataStream.IsResident){
+							fileInformation.MarkOfTheWeb = ParseZoneIdentifier(dataStream.ResidentData)
+							fileInformation.HasMarkOfTheWeb = true
 						}
-					}				
+					}
+				}
+
+				// attribute 0xC0 holds the reparse data (symbolic links, junctions, WOF compression), it is small enough to always be resident
+				if(attributeType == 192){
+					parseReparsePoint(getResidentValue(attribute), &fileInformation)
 				}
 				// Updating attribute offset and making sure we can iterateMFT
 				offsetToAttribute = offsetToAttribute + attributeLength				
 			}
+			if(int(offsetToAttribute) + 4 > len(recordBuffer)){
+				fileInformation.IsCorrupt = true
+				break
+			}
 			binary.Read(bytes.NewBuffer(recordBuffer[offsetToAttribute:offsetToAttribute +4]), binary.LittleEndian, &checkEndMarker)
 		}
+		setDisplayName(&fileInformation)
 	}
 	return fileInformation
 }
 
-func ParseNTFSHeader(driveLocation string, NTFSHeaderOffset uint32, NTFSHeaderSize uint32) internal.NTFS_BOOT_PARTITION{
+// Parses one $DATA attribute, the attribute name (UTF-16LE, stored in the attribute header) tells the stream apart.
+// Non-resident attributes can be split over several extents (attributes with the same name and a different starting VCN).
+// The $ATTRIBUTE_LIST has the same resident/non-resident layout and is parsed with it as well.
+func parseDataAttribute(attribute []byte, offsetToAttribute uint16, recordOffset int64, NTFSOffset uint64, clusterSize uint32, outputMode int) internal.STREAM_INFO{
+	var dataStream internal.STREAM_INFO
+	var noneResidentFlag uint8
+	var attributeNameLength uint8
+	var attributeNameOffset uint16
+	var ofssetToAttributeData uint16
+	binary.Read(bytes.NewBuffer(attribute[8:9]), binary.LittleEndian, &noneResidentFlag)
+	binary.Read(bytes.NewBuffer(attribute[9:10]), binary.LittleEndian, &attributeNameLength)
+	binary.Read(bytes.NewBuffer(attribute[10:12]), binary.LittleEndian, &attributeNameOffset)
+	if(attributeNameLength > 0){
+		dataStream.Name = internal.DecodeUTF16LE(attribute[attributeNameOffset:attributeNameOffset + uint16(attributeNameLength)*2])
+	}
+
+	// Data in file record
+	if noneResidentFlag == 0{
+		var residentLength uint32
+		binary.Read(bytes.NewBuffer(attribute[16:20]), binary.LittleEndian, &residentLength)
+		binary.Read(bytes.NewBuffer(attribute[20:22]), binary.LittleEndian, &ofssetToAttributeData)
+		dataStream.DataLength = uint64(residentLength)
+		// To do calculate this back, to get absolute offset (note that the record offset, also includes the NTFS offset)
+		dataStream.FullDataOffset = uint64(offsetToAttribute) + uint64(ofssetToAttributeData) + uint64(recordOffset)
+		dataStream.IsResident = true
+		// The record buffer is reused for the next record, and the raw disk bytes still hold the update sequence number at the end of every sector
+		residentValue := getResidentValue(attribute)
+		dataStream.ResidentData = make([]byte, len(residentValue))
+		copy(dataStream.ResidentData, residentValue)
+	}
+
+	// Data outside
+	if noneResidentFlag == 1{
+		var startingVCN int64
+		var attributeFlags uint16
+		var compressionUnit uint16
+		binary.Read(bytes.NewBuffer(attribute[16:24]), binary.LittleEndian, &startingVCN)
+		// Flag 0x0001 marks a compressed attribute, the compression unit is only set when the data is actually compressed
+		binary.Read(bytes.NewBuffer(attribute[12:14]), binary.LittleEndian, &attributeFlags)
+		binary.Read(bytes.NewBuffer(attribute[34:36]), binary.LittleEndian, &compressionUnit)
+		dataStream.IsCompressed = attributeFlags & 0x0001 != 0 && compressionUnit != 0
+		if(dataStream.IsCompressed){
+			dataStream.CompressionUnit = 1 << compressionUnit
+		}
+		// The sizes are only maintained in the first extent (starting at VCN 0)
+		if(startingVCN == 0){
+			binary.Read(bytes.NewBuffer(attribute[48:56]), binary.LittleEndian, &dataStream.DataLength)
+		}
+		binary.Read(bytes.NewBuffer(attribute[32:34]), binary.LittleEndian, &ofssetToAttributeData)
+		// In some exceptional cases $REPAIR file, a data offset is specified, however, the datarun is empty as repair might not be configured
+		// To deal with this, check if ofssetToAttributeData doesn't overflow the attribute array, in case it does, lets ignore this.
+		if (int(ofssetToAttributeData) + 1) >= len(attribute){
+			if(outputMode == 1){
+				fmt.Println("Exceptional case where $DATA is empty, ignoring this entry")
+			}
+		}	
+	
+		if (int(ofssetToAttributeData) + 1) < len(attribute){
+			dataStream.DataRuns = DecodeDataRuns(attribute, int(ofssetToAttributeData), startingVCN, clusterSize)
+			// The file offset points to the start of the file (VCN 0), which doesn't exist on disk when that run is sparse
+			if(len(dataStream.DataRuns) > 0 && dataStream.DataRuns[0].VCN == 0 && !dataStream.DataRuns[0].IsSparse){
+				dataStream.DataCluster = uint64(dataStream.DataRuns[0].LCN)
+				dataStream.HasDataRun = true
+				dataStream.FullDataOffset =  NTFSOffset + (uint64(clusterSize) * dataStream.DataCluster)
+			}
+		}
+	}
+	return dataStream
+}
+
+// The fixed header (24 bytes resident, 64 bytes non-resident) has to be complete, and the name and resident value it points to have to lie within the attribute
+func isAttributeHeaderValid(attribute []byte) bool{
+	if(len(attribute) < 24){
+		return false
+	}
+	nameEnd := int(binary.LittleEndian.Uint16(attribute[10:12])) + int(attribute[9])*2
+	if(attribute[9] > 0 && nameEnd > len(attribute)){
+		return false
+	}
+	if(attribute[8] == 0){
+		valueEnd := uint64(binary.LittleEndian.Uint16(attribute[20:22])) + uint64(binary.LittleEndian.Uint32(attribute[16:20]))
+		return valueEnd <= uint64(len(attribute))
+	}
+	return len(attribute) >= 64
+}
+
+// The value of a resident attribute, empty when the header points outside the attribute
+func getResidentValue(attribute []byte) []byte{
+	if(len(attribute) < 22){
+		return nil
+	}
+	valueLength := binary.LittleEndian.Uint32(attribute[16:20])
+	valueOffset := uint32(binary.LittleEndian.Uint16(attribute[20:22]))
+	if(uint64(valueOffset) + uint64(valueLength) > uint64(len(attribute))){
+		return nil
+	}
+	return attribute[valueOffset:valueOffset + valueLength]
+}
+
+// Reparse data starts with the tag, the data length and two reserved bytes: https://learn.microsoft.com/en-us/windows-hardware/drivers/ddi/ntifs/ns-ntifs-_reparse_data_buffer
+// Junctions and symbolic links follow with the offsets and lengths of the substitute and print name, symbolic links add a flags field.
+// For WOF (CompactOS) it is followed by WOF_EXTERNAL_INFO (version, provider) and, for the file provider, FILE_PROVIDER_EXTERNAL_INFO_V1 (version, algorithm).
+func parseReparsePoint(reparseData []byte, fileInformation *internal.FILE_INFO){
+	const wofProviderFile = 2
+	if(len(reparseData) < 8){
+		return
+	}
+	reparsePoint := internal.REPARSE_POINT{Tag: binary.LittleEndian.Uint32(reparseData[0:4])}
+	switch reparsePoint.Tag{
+	case internal.ReparseTagMountPoint, internal.ReparseTagSymlink:
+		pathBufferOffset := 16
+		if(reparsePoint.Tag == internal.ReparseTagSymlink){
+			pathBufferOffset = 20
+			if(len(reparseData) >= 20){
+				reparsePoint.IsRelative = binary.LittleEndian.Uint32(reparseData[16:20]) & 1 == 1
+			}
+		}
+		if(len(reparseData) >= pathBufferOffset){
+			reparsePoint.TargetPath = getReparseName(reparseData, pathBufferOffset, 8)
+			reparsePoint.PrintName = getReparseName(reparseData, pathBufferOffset, 12)
+		}
+	case internal.ReparseTagAppExecLink:
+		// Version followed by NUL terminated strings: package family name, application user model ID, target executable
+		if(len(reparseData) > 12){
+			appExecLinkStrings := strings.Split(internal.DecodeUTF16LE(reparseData[12:]), "\x00")
+			if(len(appExecLinkStrings) >= 3){
+				reparsePoint.TargetPath = appExecLinkStrings[2]
+				reparsePoint.PrintName = appExecLinkStrings[0]
+			}
+		}
+	case internal.ReparseTagLxSymlink:
+		// Version followed by the UTF-8 target, as written by the Linux side
+		if(len(reparseData) > 12){
+			reparsePoint.TargetPath = string(reparseData[12:])
+			reparsePoint.IsRelative = !strings.HasPrefix(reparsePoint.TargetPath, "/")
+		}
+	case internal.ReparseTagWof:
+		if(len(reparseData) >= 24 && binary.LittleEndian.Uint32(reparseData[12:16]) == wofProviderFile){
+			fileInformation.IsWofCompressed = true
+			fileInformation.WofAlgorithm = binary.LittleEndian.Uint32(reparseData[20:24])
+		}
+	}
+	fileInformation.ReparsePoint = reparsePoint
+	fileInformation.HasReparsePoint = true
+}
+
+// Reads the name whose offset and length (in bytes, relative to the path buffer) are stored at fieldOffset
+func getReparseName(reparseData []byte, pathBufferOffset int, fieldOffset int) string{
+	nameOffset := pathBufferOffset + int(binary.LittleEndian.Uint16(reparseData[fieldOffset:fieldOffset + 2]))
+	nameLength := int(binary.LittleEndian.Uint16(reparseData[fieldOffset + 2:fieldOffset + 4]))
+	if(nameOffset + nameLength > len(reparseData)){
+		return ""
+	}
+	return internal.DecodeUTF16LE(reparseData[nameOffset:nameOffset + nameLength])
+}
+
+// Zone.Identifier is a small INI file, e.g. [ZoneTransfer] ZoneId=3 ReferrerUrl=... HostUrl=...
+// Most browsers write it as ANSI/UTF-8, some tools use UTF-16LE with a byte order mark.
+func ParseZoneIdentifier(content []byte) internal.MARK_OF_THE_WEB{
+	markOfTheWeb := internal.MARK_OF_THE_WEB{ZoneID: -1}
+	var text string
+	if(bytes.HasPrefix(content, []byte{0xFF, 0xFE})){
+		text = internal.DecodeUTF16LE(content[2:])
+	} else{
+		text = string(bytes.TrimPrefix(content, []byte{0xEF, 0xBB, 0xBF}))
+	}
+	for _, line := range strings.Split(text, "\n"){
+		key, value, found := strings.Cut(strings.TrimSpace(line), "=")
+		if(!found){
+			continue
+		}
+		switch strings.ToLower(strings.TrimSpace(key)){
+		case "zoneid":
+			if zoneID, err := strconv.Atoi(strings.TrimSpace(value)); err == nil{
+				markOfTheWeb.ZoneID = zoneID
+			}
+		case "referrerurl":
+			markOfTheWeb.ReferrerUrl = strings.TrimSpace(value)
+		case "hosturl":
+			markOfTheWeb.HostUrl = strings.TrimSpace(value)
+		}
+	}
+	return markOfTheWeb
+}
+
+// Adds an extent to a stream: the runs are appended in VCN order, the sizes and start offset come from the first extent
+func mergeStreamExtent(dataStream *internal.STREAM_INFO, extent internal.STREAM_INFO){
+	isFirstExtent := extent.IsResident || len(extent.DataRuns) == 0 || extent.DataRuns[0].VCN == 0
+	dataStream.DataRuns = append(dataStream.DataRuns, extent.DataRuns...)
+	sort.SliceStable(dataStream.DataRuns, func(i, j int) bool { return dataStream.DataRuns[i].VCN < dataStream.DataRuns[j].VCN })
+	if(isFirstExtent){
+		dataStream.IsResident = extent.IsResident
+		dataStream.DataLength = extent.DataLength
+		dataStream.HasDataRun = extent.HasDataRun
+		dataStream.DataCluster = extent.DataCluster
+		dataStream.FullDataOffset = extent.FullDataOffset
+		dataStream.ResidentData = extent.ResidentData
+		dataStream.IsCompressed = extent.IsCompressed
+		dataStream.CompressionUnit = extent.CompressionUnit
+	}
+}
+
+// The unnamed $DATA attribute is kept in the FILE_INFO fields, as a stream it can be merged like any other
+func getMainStream(fileInformation internal.FILE_INFO) internal.STREAM_INFO{
+	return internal.STREAM_INFO{IsResident: fileInformation.IsResident, DataLength: fileInformation.DataLength, HasDataRun: fileInformation.HasDataRun, DataCluster: fileInformation.DataCluster, FullDataOffset: fileInformation.FullDataOffset, DataRuns: fileInformation.DataRuns, ResidentData: fileInformation.ResidentData, IsCompressed: fileInformation.IsCompressed, CompressionUnit: fileInformation.CompressionUnit}
+}
+
+func setMainStream(fileInformation *internal.FILE_INFO, dataStream internal.STREAM_INFO){
+	fileInformation.IsResident = dataStream.IsResident
+	fileInformation.DataLength = dataStream.DataLength
+	fileInformation.HasDataRun = dataStream.HasDataRun
+	fileInformation.DataCluster = dataStream.DataCluster
+	fileInformation.FullDataOffset = dataStream.FullDataOffset
+	fileInformation.DataRuns = dataStream.DataRuns
+	fileInformation.ResidentData = dataStream.ResidentData
+	fileInformation.IsCompressed = dataStream.IsCompressed
+	fileInformation.CompressionUnit = dataStream.CompressionUnit
+}
+
+// Named streams are matched by name, so an alternate data stream split over several extents ends up as one stream
+func addStreamExtent(dataStreams []internal.STREAM_INFO, extent internal.STREAM_INFO) []internal.STREAM_INFO{
+	for i := range dataStreams{
+		if(dataStreams[i].Name == extent.Name){
+			mergeStreamExtent(&dataStreams[i], extent)
+			return dataStreams
+		}
+	}
+	return append(dataStreams, extent)
+}
+
+// Replaces the file content with one of its alternate data streams, so it can be carved like the file itself
+func SelectStream(fileInformation internal.FILE_INFO, stream string) (internal.FILE_INFO, bool){
+	for _, dataStream := range fileInformation.Streams{
+		if(dataStream.Name != stream){
+			continue
+		}
+		fileInformation.FileName = fileInformation.FileName + ":" + stream
+		setMainStream(&fileInformation, dataStream)
+		// A stream is carved as stored, WofCompressedData itself included
+		fileInformation.IsWofCompressed = false
+		return fileInformation, true
+	}
+	return fileInformation, false
+}
+
+// The record numbers an $ATTRIBUTE_LIST points to, other than the base record itself.
+// Entry layout: https://flatcap.github.io/linux-ntfs/ntfs/attributes/attribute_list.html
+func ParseAttributeList(attributeList []byte, baseRecord uint64) []uint64{
+	var extensionRecords []uint64
+	seenRecords := make(map[uint64]bool)
+	for offset := 0; offset + 26 <= len(attributeList); {
+		entryLength := int(binary.LittleEndian.Uint16(attributeList[offset+4:offset+6]))
+		if(entryLength < 26){
+			break
+		}
+		recordNumber, _ := internal.SplitFileReference(binary.LittleEndian.Uint64(attributeList[offset+16:offset+24]))
+		if(recordNumber != baseRecord && !seenRecords[recordNumber]){
+			seenRecords[recordNumber] = true
+			extensionRecords = append(extensionRecords, recordNumber)
+		}
+		offset = offset + entryLength
+	}
+	return extensionRecords
+}
+
+// Heavily fragmented or hard linked files spill attributes into extension records, these are read and merged into the base record
+func ResolveAttributeList(driveLocation string, volume internal.VOLUME_INFO, recordSize int64, fileInformation *internal.FILE_INFO){
+	if(!fileInformation.HasAttributeList){
+		return
+	}
+	// The blocks of a standalone $MFT file are counted in records, there are no clusters
+	clusterSize := volume.ClusterSize
+	if(volume.StandaloneMFT){
+		clusterSize = uint32(recordSize)
+	}
+	attributeList := fileInformation.AttributeList.ResidentData
+	if(!fileInformation.AttributeList.IsResident){
+		// Only a disk has the clusters of a non-resident list
+		if(volume.StandaloneMFT){
+			return
+		}
+		var listBuffer bytes.Buffer
+		if _, err := ReadDataRuns(driveLocation, fileInformation.AttributeList.DataRuns, volume.NTFSOffset, volume.ClusterSize, fileInformation.AttributeList.DataLength, &listBuffer); err != nil{
+			return
+		}
+		attributeList = listBuffer.Bytes()
+	}
+
+	for _, recordNumber := range ParseAttributeList(attributeList, uint64(fileInformation.RecordID)){
+		recordBuffer, recordOffset, ok := ReadMFTRecord(driveLocation, volume.MFTBlocks, volume.NTFSOffset, clusterSize, recordSize, int64(recordNumber))
+		if(!ok){
+			continue
+		}
+		extension := ParseMFTRecord(recordBuffer, recordOffset, volume.NTFSOffset, volume.ClusterSize, 0)
+		// A reused slot belongs to another file by now, deleting the base record already incremented its sequence number
+		if(extension.IsCorrupt || extension.BaseRecord != uint64(fileInformation.RecordID)){
+			continue
+		}
+		if(extension.BaseSequence != fileInformation.SequenceNumber && (fileInformation.IsActive || extension.BaseSequence + 1 != fileInformation.SequenceNumber)){
+			continue
+		}
+		mergeExtensionRecord(fileInformation, extension)
+	}
+	setDisplayName(fileInformation)
+}
+
+// Adds the attributes found in an extension record to its base record
+func mergeExtensionRecord(fileInformation *internal.FILE_INFO, extension internal.FILE_INFO){
+	fileInformation.FileNames = append(fileInformation.FileNames, extension.FileNames...)
+	if(extension.IsResident || len(extension.DataRuns) > 0){
+		mainStream := getMainStream(*fileInformation)
+		mergeStreamExtent(&mainStream, getMainStream(extension))
+		setMainStream(fileInformation, mainStream)
+	}
+	for _, dataStream := range extension.Streams{
+		fileInformation.Streams = addStreamExtent(fileInformation.Streams, dataStream)
+	}
+	if(extension.HasMarkOfTheWeb){
+		fileInformation.MarkOfTheWeb = extension.MarkOfTheWeb
+		fileInformation.HasMarkOfTheWeb = true
+	}
+	if(extension.HasReparsePoint){
+		fileInformation.ReparsePoint = extension.ReparsePoint
+		fileInformation.HasReparsePoint = true
+		fileInformation.IsWofCompressed = extension.IsWofCompressed
+		fileInformation.WofAlgorithm = extension.WofAlgorithm
+	}
+}
+
+// The order in which $FILE_NAME namespaces are preferred as display name, the DOS 8.3 name (e.g. PROGRA~1) is the last resort
+var namespacePreference = map[uint8]int{1: 0, 3: 0, 0: 1, 2: 2}
+
+// Picks the display name (and with it the parent and FN times) out of all $FILE_NAME attributes of the record
+func setDisplayName(fileInformation *internal.FILE_INFO){
+	if(len(fileInformation.FileNames) == 0){
+		return
+	}
+	bestName := fileInformation.FileNames[0]
+	for _, fileName := range fileInformation.FileNames[1:]{
+		if(namespacePreference[fileName.Namespace] < namespacePreference[bestName.Namespace]){
+			bestName = fileName
+		}
+	}
+	fileInformation.FileName = bestName.Name
+	fileInformation.ParentDirectory = bestName.ParentDirectory
+	fileInformation.ParentSequence = bestName.ParentSequence
+	fileInformation.FileNameCreatedUTCWinFileEpoch = bestName.CreatedUTCWinFileEpoch
+	fileInformation.FileNameModifiedUTCWinFileEpoch = bestName.ModifiedUTCWinFileEpoch
+	fileInformation.FileNameRecordModifiedUTCWinFileEpoch = bestName.RecordModifiedUTCWinFileEpoch
+	fileInformation.FileNameLastReadUTCWinFileEpoch = bestName.LastReadUTCWinFileEpoch
+}
+
+// Decodes the complete mapping pairs array (data runs) of a non-resident attribute: http://inform.pucp.edu.pe/~inf232/Ntfs/ntfs_doc_v0.5/concepts/data_runs.html
+// The header byte (nimble) of a run holds the size of the cluster count (low nibble) and of the cluster offset (high nibble).
+// The count is unsigned, the offset is signed and relative to the LCN of the previous run. A run without offset bytes is sparse (not stored on disk).
+func DecodeDataRuns(attribute []byte, dataRunOffset int, startingVCN int64, clusterSize uint32) []internal.DATA_RUN{
+	var dataRuns []internal.DATA_RUN
+	VCN := startingVCN
+	LCN := int64(0)
+
+	// The data runs end with a 0x00 header byte, or when we run out of attribute
+	for(dataRunOffset < len(attribute) && attribute[dataRunOffset] != 0){
+		var dataRun internal.DATA_RUN
+		dataRun.Nimble = attribute[dataRunOffset]
+		dataRun.ClusterCountLength, dataRun.ClusterOffsetLength = internal.ParseNimble(dataRun.Nimble)
+		countStart := dataRunOffset + 1
+		offsetStart := countStart + dataRun.ClusterCountLength
+		offsetEnd := offsetStart + dataRun.ClusterOffsetLength
+		if(dataRun.ClusterCountLength == 0 || dataRun.ClusterCountLength > 8 || dataRun.ClusterOffsetLength > 8 || offsetEnd > len(attribute)){
+			// Garbage, e.g. a partially overwritten record
+			break
+		}
+
+		dataRun.VCN = VCN
+		dataRun.ClusterCount = int64(internal.ReadLittleEndianUnsigned(attribute[countStart:offsetStart]))
+		if(dataRun.ClusterOffsetLength == 0){
+			dataRun.IsSparse = true
+		} else{
+			LCN = LCN + internal.ReadLittleEndianSigned(attribute[offsetStart:offsetEnd])
+			dataRun.LCN = LCN
+			dataRun.AbsoluteOffsetWithinNTFSPartition = LCN * int64(clusterSize)
+		}
+		dataRuns = append(dataRuns, dataRun)
+
+		VCN = VCN + dataRun.ClusterCount
+		dataRunOffset = offsetEnd
+	}
+	return dataRuns
+}
+
+// Reassembles the content of a non-resident attribute from its data runs (sorted by VCN).
+// Sparse runs (and gaps between runs) read as zeros and the output is truncated to the real size of the attribute.
+// Whole clusters are read at a time, which keeps reads on physical disks sector aligned.
+func ReadDataRuns(driveLocation string, dataRuns []internal.DATA_RUN, NTFSOffset uint64, clusterSize uint32, realSize uint64, output io.Writer) (uint64, error){
+	const clustersPerRead = 256
+	var bytesWritten uint64
+	handle, err := os.Open(driveLocation)
+	if(err != nil){
+		return 0, err
+	}
+	defer handle.Close()
+
+	readBuffer := make([]byte, clustersPerRead*int64(clusterSize))
+	zeroBuffer := make([]byte, len(readBuffer))
+	writeChunk := func(chunk []byte) error{
+		if(bytesWritten + uint64(len(chunk)) > realSize){
+			chunk = chunk[:realSize - bytesWritten]
+		}
+		_, err := output.Write(chunk)
+		bytesWritten = bytesWritten + uint64(len(chunk))
+		return err
+	}
+
+	for _, dataRun := range dataRuns{
+		// Zero fill a gap in the run list (e.g. an extension record that couldn't be read)
+		runStart := uint64(dataRun.VCN) * uint64(clusterSize)
+		for(bytesWritten < runStart && bytesWritten < realSize){
+			gap := runStart - bytesWritten
+			if(gap > uint64(len(zeroBuffer))){
+				gap = uint64(len(zeroBuffer))
+			}
+			if err := writeChunk(zeroBuffer[:gap]); err != nil{
+				return bytesWritten, err
+			}
+		}
+
+		for cluster := int64(0); cluster < dataRun.ClusterCount && bytesWritten < realSize; cluster += clustersPerRead{
+			clustersToRead := dataRun.ClusterCount - cluster
+			if(clustersToRead > clustersPerRead){
+				clustersToRead = clustersPerRead
+			}
+			chunk := zeroBuffer[:clustersToRead*int64(clusterSize)]
+			if(!dataRun.IsSparse){
+				chunk = readBuffer[:clustersToRead*int64(clusterSize)]
+				handle.Seek(int64(NTFSOffset) + (dataRun.LCN + cluster)*int64(clusterSize), 0)
+				if _, err := io.ReadFull(handle, chunk); err != nil{
+					return bytesWritten, err
+				}
+			}
+			if err := writeChunk(chunk); err != nil{
+				return bytesWritten, err
+			}
+		}
+	}
+	return bytesWritten, nil
+}
+
+func ParseNTFSHeader(driveLocation string, NTFSHeaderOffset uint64, NTFSHeaderSize uint32) internal.NTFS_BOOT_PARTITION{
 	var ntfsHeader internal.NTFS_BOOT_PARTITION
 	handle, error := os.Open(driveLocation)
 	if(error == nil){
@@ -231,6 +737,17 @@ func ParseNTFSHeader(driveLocation string, NTFSHeaderOffset uint32, NTFSHeaderSi
 	return ntfsHeader
 }
 
+func IsNTFSBootSector(ntfsHeader internal.NTFS_BOOT_PARTITION) bool{
+	NTFSOEMIndicator := [8]byte{78, 84, 70, 83, 32, 32, 32, 32}		// "NTFS    "
+	return ntfsHeader.OemID == NTFSOEMIndicator
+}
+
+// Checks for an NTFS boot sector at the given offset, without any partition table involved
+func IsNTFSVolume(driveLocation string, NTFSHeaderOffset uint64) bool{
+	const NTFSBootSectorSize = 512
+	return IsNTFSBootSector(ParseNTFSHeader(driveLocation, NTFSHeaderOffset, NTFSBootSectorSize))
+}
+
 func ParseMFTEntry(mftRecordBuffer []byte) internal.MFT_ENTRY{
 	var mftEntry internal.MFT_ENTRY
 	
@@ -266,7 +783,7 @@ func parsePartition(partitionBuffer []byte)internal.PARTITIONENTRY{
 }
 
 
-func ParsePartitions(driveLocation string, partitionTableOffset uint32, partitionTableEntrySize uint32, partitionTableEntries uint32) (int, []internal.PARTITIONENTRY){
+func ParsePartitions(driveLocation string, partitionTableOffset uint64, partitionTableEntrySize uint32, partitionTableEntries uint32) (int, []internal.PARTITIONENTRY){
 	partitionsFound := 0
 	var partitionArray []internal.PARTITIONENTRY
 	handle, error := os.Open(driveLocation)
@@ -316,67 +833,167 @@ func ParseGPTHeader(driveLocation string, logicalBlockAddressSize int64, LBAOffs
 }
 
 
-func GetMFTOffsetLocationsFromMFT(driveLocation string, MFTOffset uint32, recordSize int64, NTFSOffset uint32)[]int{
-	// This function parses the $DATA entry of the $MFT file, to find all MFT blocks and zones
-	// No need to parse the full record, this will be done through a more systematic iterator.
-	// Flag indicating $DATA attribute = 0x80 https://learn.microsoft.com/en-us/windows/win32/devnotes/attribute-list-entry,
-	handle, error := os.Open(driveLocation)
-	dataType := uint16(128)	// Searching for attribute of type 0x80, e.g. 128 in dec
-	var mftClusterOffsets []int
+func parseMBRPartitionEntry(entryBuffer []byte) internal.MBRPARTITIONENTRY{
+	var partitionEntry internal.MBRPARTITIONENTRY
 
+	binary.Read(bytes.NewBuffer(entryBuffer[0:1]), binary.LittleEndian, &partitionEntry.BootIndicator)
+	binary.Read(bytes.NewBuffer(entryBuffer[1:4]), binary.LittleEndian, &partitionEntry.StartingCHS)
+	binary.Read(bytes.NewBuffer(entryBuffer[4:5]), binary.LittleEndian, &partitionEntry.PartitionType)
+	binary.Read(bytes.NewBuffer(entryBuffer[5:8]), binary.LittleEndian, &partitionEntry.EndingCHS)
+	binary.Read(bytes.NewBuffer(entryBuffer[8:12]), binary.LittleEndian, &partitionEntry.StartingLBA)
+	binary.Read(bytes.NewBuffer(entryBuffer[12:16]), binary.LittleEndian, &partitionEntry.NumberOfSectors)
+
+	return partitionEntry
+}
+
+// The MBR and every EBR share the same layout, only the meaning of the entries differs
+func parseMBRSector(sectorBuffer []byte) internal.MBRHEADER{
+	var mbrHeader internal.MBRHEADER
+
+	binary.Read(bytes.NewBuffer(sectorBuffer[0:440]), binary.LittleEndian, &mbrHeader.BootstrapCode)
+	binary.Read(bytes.NewBuffer(sectorBuffer[440:444]), binary.LittleEndian, &mbrHeader.DiskSignature)
+	binary.Read(bytes.NewBuffer(sectorBuffer[444:446]), binary.LittleEndian, &mbrHeader.Reserved)
+	for i := 0; i < 4; i++ {
+		mbrHeader.PartitionEntries[i] = parseMBRPartitionEntry(sectorBuffer[446+i*16:446+(i+1)*16])
+	}
+	binary.Read(bytes.NewBuffer(sectorBuffer[510:512]), binary.LittleEndian, &mbrHeader.BootSignature)
+
+	return mbrHeader
+}
+
+func readMBRSector(handle *os.File, logicalBlockAddressSize int64, LBAOffset int64) internal.MBRHEADER{
+	sectorBuffer := make([]byte, logicalBlockAddressSize)
+	handle.Seek(logicalBlockAddressSize*LBAOffset,0)
+	handle.Read(sectorBuffer)
+	return parseMBRSector(sectorBuffer)
+}
+
+func ParseMBR(driveLocation string, logicalBlockAddressSize int64) internal.MBRHEADER{
+	var mbrHeader internal.MBRHEADER
+	handle, error := os.Open(driveLocation)
 	if(error == nil){
-		mftRecordBuffer := make([]byte, recordSize)
-		handle.Seek(int64(MFTOffset),0)		
-		handle.Read(mftRecordBuffer)
+		mbrHeader = readMBRSector(handle, logicalBlockAddressSize, 0)
+	}
+	handle.Close()
+	return mbrHeader
+}
 
-		var offsetToAttribute uint16
-		var attributeType uint16
-		var attributeLength uint16
-		
-		binary.Read(bytes.NewBuffer(mftRecordBuffer[20:22]), binary.LittleEndian, &offsetToAttribute)
-		binary.Read(bytes.NewBuffer(mftRecordBuffer[offsetToAttribute:offsetToAttribute+4]), binary.LittleEndian, &attributeType)
-		binary.Read(bytes.NewBuffer(mftRecordBuffer[offsetToAttribute+4:offsetToAttribute+4+4]), binary.LittleEndian, &attributeLength)
-		
-		// This only works because we are certain that $MFT actually has the $DATA attribute
-		for(attributeType != dataType){
-			offsetToAttribute = offsetToAttribute + attributeLength
-			binary.Read(bytes.NewBuffer(mftRecordBuffer[offsetToAttribute:offsetToAttribute+4]), binary.LittleEndian, &attributeType)
-			binary.Read(bytes.NewBuffer(mftRecordBuffer[offsetToAttribute+4:offsetToAttribute+4+4]), binary.LittleEndian, &attributeLength)
-		}
-		fmt.Printf("  --> $DATA attribute of $MFT found at record offset: %d\n", offsetToAttribute)
-		// The name of the Attribute is $DATA, the offset is stored in the header on the 10th to twelfth byte. Hence the data runs start at attributes offset + name offset
-		
-		var offsetToDATAAttribute uint16
-		var dataAttributeLenght uint16
-		var dataRunOffset uint16
-		fullDiskMFTBlockOffset := int64(NTFSOffset)
-		binary.Read(bytes.NewBuffer(mftRecordBuffer[offsetToAttribute+4:offsetToAttribute+8]), binary.LittleEndian, &dataAttributeLenght)
-		binary.Read(bytes.NewBuffer(mftRecordBuffer[offsetToAttribute+10:offsetToAttribute+12]), binary.LittleEndian, &offsetToDATAAttribute)
-		dataRunCounter := int(dataAttributeLenght) - int(offsetToDATAAttribute)
-		dataRunOffset = offsetToAttribute + offsetToDATAAttribute
-
-		// Post condition for looping through the data runs
-		//because attribute types are assending, and the first byte of the attribute header contains a type, we can assume that we are past our data runs if the nimble exceeds 0x44 (68) or is just 0
-		for (dataRunCounter > 3){
-			var dataRun internal.DATA_RUN
-			// To save space, the dataRun varies in space, the only thing we know for sure is that the length is the first byte: http://inform.pucp.edu.pe/~inf232/Ntfs/ntfs_doc_v0.5/concepts/data_runs.html
-			binary.Read(bytes.NewBuffer(mftRecordBuffer[dataRunOffset:dataRunOffset+1]), binary.LittleEndian, &dataRun.Nimble)
-			dataRun.ClusterCountLength, dataRun.ClusterOffsetLength = internal.ParseNimble(dataRun.Nimble)
-			clusterStart := int(dataRunOffset) + 1 + dataRun.ClusterCountLength
-
-			// **************** Welcome to casting, converting and formatting hell! **************** 
-			offsetToMFTBlock := internal.ConvertClusterOffsetHexFromDatarunToDecimalOffset(dataRun.ClusterOffsetLength, mftRecordBuffer, clusterStart)
-			
-			// Fix the offsets to the next datarun
-			dataRunOffset = dataRunOffset + 1 + uint16(dataRun.ClusterCountLength) + uint16(dataRun.ClusterOffsetLength)	//need + 1 as this indicates the length byte
-			dataRunCounter = int(dataRunCounter) - 1 - dataRun.ClusterCountLength - dataRun.ClusterOffsetLength
-			
-			//To get to the right offset, we need to add the offset from the previous data run 
-			fullDiskMFTBlockOffset = int64(fullDiskMFTBlockOffset) + int64(offsetToMFTBlock)
-			mftClusterOffsets = append(mftClusterOffsets, int(fullDiskMFTBlockOffset))
+func IsValidMBR(mbrHeader internal.MBRHEADER) bool{
+	return mbrHeader.BootSignature == [2]byte{85, 170}		// 0x55 0xAA
+}
+
+// A GPT disk keeps a legacy MBR at LBA0, with a single partition of type 0xEE covering the disk
+func IsProtectiveMBR(mbrHeader internal.MBRHEADER) bool{
+	for _, partition := range mbrHeader.PartitionEntries{
+		if partition.PartitionType == 238{
+			return true
 		}
+	}
+	return false
+}
+
+func isExtendedPartition(partitionType uint8) bool{
+	// 0x05 = CHS extended, 0x0F = LBA extended, 0x85 = Linux extended
+	return partitionType == 5 || partitionType == 15 || partitionType == 133
+}
 
+// Returns all primary and logical partitions, with their StartingLBA converted to an absolute LBA
+func ParseMBRPartitions(driveLocation string, logicalBlockAddressSize int64) (int, []internal.MBRPARTITIONENTRY){
+	partitionsFound := 0
+	var partitionArray []internal.MBRPARTITIONENTRY
+	handle, error := os.Open(driveLocation)
+	if(error == nil){
+		mbrHeader := readMBRSector(handle, logicalBlockAddressSize, 0)
+		for _, partition := range mbrHeader.PartitionEntries{
+			if partition.PartitionType == 0{
+				continue
+			}
+			if !isExtendedPartition(partition.PartitionType){
+				partitionArray = append(partitionArray, partition)
+				partitionsFound++
+				continue
+			}
+			// Logical partitions are stored in a chain of Extended Boot Records (EBR): https://en.wikipedia.org/wiki/Extended_boot_record
+			// The first entry of an EBR is relative to the EBR itself, the second (next EBR) is relative to the start of the extended partition
+			extendedStart := int64(partition.StartingLBA)
+			ebrLBA := extendedStart
+			visitedEBRs := make(map[int64]bool)
+			for !visitedEBRs[ebrLBA] {
+				// Guard against broken images that make the chain loop back on itself
+				visitedEBRs[ebrLBA] = true
+				ebr := readMBRSector(handle, logicalBlockAddressSize, ebrLBA)
+				if !IsValidMBR(ebr){
+					fmt.Printf("  --> Invalid EBR signature at LBA: %d, stopping logical partition scan\n", ebrLBA)
+					break
+				}
+				logicalPartition := ebr.PartitionEntries[0]
+				if logicalPartition.PartitionType != 0{
+					logicalPartition.StartingLBA = uint32(ebrLBA + int64(logicalPartition.StartingLBA))
+					partitionArray = append(partitionArray, logicalPartition)
+					partitionsFound++
+				}
+				nextEBR := ebr.PartitionEntries[1]
+				if !isExtendedPartition(nextEBR.PartitionType){
+					break
+				}
+				ebrLBA = extendedStart + int64(nextEBR.StartingLBA)
+			}
+		}
 	}
 	handle.Close()
-	return mftClusterOffsets
-}
\ No newline at end of file
+	return partitionsFound, partitionArray
+}
+
+func GetMFTOffsetLocationsFromMFT(driveLocation string, volume internal.VOLUME_INFO, MFTOffset uint64, recordSize int64)([]internal.DATA_RUN, uint64){
+	// This function parses the $MFT record (record 0) itself, its unnamed $DATA maps all MFT blocks and zones, including their length.
+	// A heavily fragmented $MFT doesn't fit its data runs in one record, the remaining extents are in extension records listed by its $ATTRIBUTE_LIST.
+	handle, error := os.Open(driveLocation)
+	if(error != nil){
+		return nil, 0
+	}
+	defer handle.Close()
+
+	mftRecordBuffer := make([]byte, recordSize)
+	handle.Seek(int64(MFTOffset),0)
+	if _, error = io.ReadFull(handle, mftRecordBuffer); error != nil{
+		fmt.Println("  --> [!] Unable to read the $MFT record:", error)
+		return nil, 0
+	}
+	// The data runs of a fragmented $MFT can easily cross the first sector boundary, so the fixups have to match
+	mftRecord := ParseMFTRecord(mftRecordBuffer, int64(MFTOffset), volume.NTFSOffset, volume.ClusterSize, 0)
+	if(mftRecord.IsCorrupt || len(mftRecord.DataRuns) == 0){
+		fmt.Println("  --> [!] The $MFT record is corrupt, unable to locate the MFT blocks")
+		return nil, 0
+	}
+	// The extension records are looked up through the runs of the base record, Windows keeps them in the first MFT block
+	volume.MFTBlocks = mftRecord.DataRuns
+	ResolveAttributeList(driveLocation, volume, recordSize, &mftRecord)
+	fmt.Printf("  --> $DATA attribute of $MFT holds %d data runs\n", len(mftRecord.DataRuns))
+	// The real size of the $MFT tells us how many record slots are in use, the allocated runs can be larger
+	return mftRecord.DataRuns, mftRecord.DataLength
+}
+// Reads record N straight from disk, the $MFT data runs map its position within the $MFT onto the volume.
+// Returns the raw record (fixups are applied by ParseMFTRecord) and its absolute offset.
+func ReadMFTRecord(driveLocation string, MFTBlocks []internal.DATA_RUN, NTFSOffset uint64, clusterSize uint32, recordSize int64, recordNumber int64) ([]byte, int64, bool){
+	recordPosition := recordNumber * recordSize
+	for _, MFTBlock := range MFTBlocks{
+		blockStart := MFTBlock.VCN * int64(clusterSize)
+		blockEnd := blockStart + MFTBlock.ClusterCount*int64(clusterSize)
+		if(recordPosition < blockStart || recordPosition + recordSize > blockEnd || MFTBlock.IsSparse){
+			continue
+		}
+		recordOffset := int64(NTFSOffset) + MFTBlock.AbsoluteOffsetWithinNTFSPartition + recordPosition - blockStart
+		handle, err := os.Open(driveLocation)
+		if(err != nil){
+			return nil, 0, false
+		}
+		defer handle.Close()
+		recordBuffer := make([]byte, recordSize)
+		handle.Seek(recordOffset, 0)
+		if _, err := io.ReadFull(handle, recordBuffer); err != nil{
+			return nil, 0, false
+		}
+		return recordBuffer, recordOffset, true
+	}
+	return nil, 0, false
+}
@@ -0,0 +1,366 @@
+package parser
+
+import "bytes"
+import "encoding/binary"
+import "os"
+import "path/filepath"
+import "testing"
+import "MFS2SQL/internal"
+
+// Writes the update sequence array at offset 48 of a 1024 byte record: the number 0xABCD followed by the original last word of both strides
+func protectRecord(record []byte){
+	binary.LittleEndian.PutUint16(record[4:6], 48)
+	binary.LittleEndian.PutUint16(record[6:8], 3)
+	copy(record[48:50], []byte{0xCD, 0xAB})
+	copy(record[50:52], record[510:512])
+	copy(record[52:54], record[1022:1024])
+	copy(record[510:512], []byte{0xCD, 0xAB})
+	copy(record[1022:1024], []byte{0xCD, 0xAB})
+}
+
+// Returns the protected record and the content it should have after the fixups
+func newFixupRecord() ([]byte, []byte){
+	record := make([]byte, 1024)
+	copy(record[0:4], "FILE")
+	for i := 56; i < len(record); i++{
+		record[i] = byte(i)
+	}
+	original := append([]byte(nil), record...)
+	protectRecord(record)
+	copy(original[0:54], record[0:54])
+	return record, original
+}
+
+// An in use FILE record (number 42) holding the given attributes, followed by the end marker
+func newFileRecord(attributes []byte) []byte{
+	record := make([]byte, 1024)
+	copy(record[0:4], "FILE")
+	binary.LittleEndian.PutUint16(record[20:22], 56)
+	binary.LittleEndian.PutUint16(record[22:24], 1)
+	binary.LittleEndian.PutUint32(record[44:48], 42)
+	copy(record[56:], attributes)
+	binary.LittleEndian.PutUint32(record[56 + len(attributes):], 0xFFFFFFFF)
+	protectRecord(record)
+	return record
+}
+
+// A resident attribute with a 24 byte header and the value right after it
+func newResidentAttribute(attributeType uint32, value []byte) []byte{
+	attribute := make([]byte, (24 + len(value) + 7) &^ 7)
+	binary.LittleEndian.PutUint32(attribute[0:4], attributeType)
+	binary.LittleEndian.PutUint32(attribute[4:8], uint32(len(attribute)))
+	binary.LittleEndian.PutUint32(attribute[16:20], uint32(len(value)))
+	binary.LittleEndian.PutUint16(attribute[20:22], 24)
+	copy(attribute[24:], value)
+	return attribute
+}
+
+func newFileNameValue(name string) []byte{
+	value := make([]byte, 66 + len(name)*2)
+	binary.LittleEndian.PutUint64(value[0:8], 5 | 5 << 48)
+	value[64] = uint8(len(name))
+	value[65] = 1
+	for i, character := range name{
+		value[66 + i*2] = byte(character)
+	}
+	return value
+}
+
+func TestApplyFixupsRestoresBothStrides(t *testing.T){
+	record, original := newFixupRecord()
+	if(!ApplyFixups(record)){
+		t.Fatal("valid record was rejected")
+	}
+	if(!bytes.Equal(record, original)){
+		t.Fatalf("stride ends not restored: got %x %x, want %x %x", record[510:512], record[1022:1024], original[510:512], original[1022:1024])
+	}
+}
+
+func TestApplyFixupsRejectsTornStride(t *testing.T){
+	record, _ := newFixupRecord()
+	// The second sector was written by a later transfer than the first one
+	copy(record[1022:1024], []byte{0xCE, 0xAB})
+	torn := append([]byte(nil), record...)
+	if(ApplyFixups(record)){
+		t.Fatal("torn record was accepted")
+	}
+	if(!bytes.Equal(record, torn)){
+		t.Fatal("torn record was partially restored")
+	}
+}
+
+func TestDecodeDataRuns(t *testing.T){
+	const clusterSize = 4096
+	runList := []byte{
+		0x21, 0x10, 0x00, 0x01,			// 16 clusters at LCN 256
+		0x01, 0x08,						// 8 sparse clusters
+		0x11, 0x04, 0xF0,				// 4 clusters at LCN 256 - 16 = 240
+		0x88, 0x01, 0, 0, 0, 0, 0, 0, 0, 0x10, 0, 0, 0, 0, 0, 0, 0,		// 8 byte count and offset: 1 cluster at LCN 240 + 16
+		0x00,
+	}
+	dataRuns := DecodeDataRuns(runList, 0, 10, clusterSize)
+	want := []internal.DATA_RUN{
+		{VCN: 10, LCN: 256, ClusterCount: 16},
+		{VCN: 26, ClusterCount: 8, IsSparse: true},
+		{VCN: 34, LCN: 240, ClusterCount: 4},
+		{VCN: 38, LCN: 256, ClusterCount: 1},
+	}
+	if(len(dataRuns) != len(want)){
+		t.Fatalf("got %d runs, want %d", len(dataRuns), len(want))
+	}
+	for i, dataRun := range dataRuns{
+		if(dataRun.VCN != want[i].VCN || dataRun.LCN != want[i].LCN || dataRun.ClusterCount != want[i].ClusterCount || dataRun.IsSparse != want[i].IsSparse){
+			t.Errorf("run %d: got VCN %d LCN %d count %d sparse %t, want VCN %d LCN %d count %d sparse %t", i,
+				dataRun.VCN, dataRun.LCN, dataRun.ClusterCount, dataRun.IsSparse, want[i].VCN, want[i].LCN, want[i].ClusterCount, want[i].IsSparse)
+		}
+		if(!dataRun.IsSparse && dataRun.AbsoluteOffsetWithinNTFSPartition != dataRun.LCN*clusterSize){
+			t.Errorf("run %d: offset %d doesn't match LCN %d", i, dataRun.AbsoluteOffsetWithinNTFSPartition, dataRun.LCN)
+		}
+	}
+	if(dataRuns[1].AbsoluteOffsetWithinNTFSPartition != 0){
+		t.Error("sparse run has a disk offset")
+	}
+}
+
+func TestParseMFTRecord(t *testing.T){
+	standardInformation := make([]byte, 72)
+	binary.LittleEndian.PutUint32(standardInformation[52:56], 0x101)
+	attributes := append(newResidentAttribute(0x10, standardInformation), newResidentAttribute(0x30, newFileNameValue("file.txt"))...)
+	fileInformation := ParseMFTRecord(newFileRecord(attributes), 0, 0, 4096, 0)
+	if(fileInformation.IsCorrupt || fileInformation.RecordID != 42 || fileInformation.FileName != "file.txt" || fileInformation.ParentDirectory != 5 || fileInformation.SecurityID != 0x101){
+		t.Fatalf("got %+v", fileInformation)
+	}
+}
+
+func TestParseMFTRecordOutOfBounds(t *testing.T){
+	tooLongValue := newResidentAttribute(0x10, make([]byte, 72))
+	binary.LittleEndian.PutUint32(tooLongValue[16:20], 0x400)
+	tooLongName := newResidentAttribute(0x30, newFileNameValue("file.txt"))
+	tooLongName[24 + 64] = 200
+	shortStandardInformation := newResidentAttribute(0x10, make([]byte, 16))
+	shortNonResident := newResidentAttribute(0x80, make([]byte, 16))
+	shortNonResident[8] = 1
+	// A non-resident $FILE_NAME, bytes 16-22 are the starting VCN and would be read as value length and offset
+	nonResidentFileName := make([]byte, 72)
+	binary.LittleEndian.PutUint32(nonResidentFileName[0:4], 0x30)
+	binary.LittleEndian.PutUint32(nonResidentFileName[4:8], 72)
+	nonResidentFileName[8] = 1
+	binary.LittleEndian.PutUint32(nonResidentFileName[16:20], 66)
+	binary.LittleEndian.PutUint16(nonResidentFileName[20:22], 512)
+	nonResidentStandardInformation := append([]byte(nil), nonResidentFileName...)
+	binary.LittleEndian.PutUint32(nonResidentStandardInformation[0:4], 0x10)
+	binary.LittleEndian.PutUint32(nonResidentStandardInformation[16:20], 72)
+	tests := map[string][]byte{
+		"value outside of the attribute": tooLongValue,
+		"name outside of the value": tooLongName,
+		"short $STANDARD_INFORMATION": shortStandardInformation,
+		"short non-resident header": shortNonResident,
+		"non-resident $FILE_NAME": nonResidentFileName,
+		"non-resident $STANDARD_INFORMATION": nonResidentStandardInformation,
+	}
+	for name, attribute := range tests{
+		fileInformation := ParseMFTRecord(newFileRecord(attribute), 0, 0, 4096, 0)
+		if(!fileInformation.IsCorrupt || fileInformation.RecordID != 42){
+			t.Errorf("%s: record not marked as corrupt", name)
+		}
+	}
+	if(!ParseMFTRecord(make([]byte, 40), 0, 0, 4096, 0).IsCorrupt){
+		t.Error("truncated record not marked as corrupt")
+	}
+}
+
+func TestParseDataAttributeCompressionUnit(t *testing.T){
+	attribute := make([]byte, 72)
+	binary.LittleEndian.PutUint32(attribute[0:4], 0x80)
+	binary.LittleEndian.PutUint32(attribute[4:8], 72)
+	attribute[8] = 1
+	binary.LittleEndian.PutUint16(attribute[12:14], 0x0001)
+	binary.LittleEndian.PutUint16(attribute[32:34], 64)
+	binary.LittleEndian.PutUint16(attribute[34:36], 2)
+	binary.LittleEndian.PutUint64(attribute[48:56], 8192)
+	copy(attribute[64:], []byte{0x11, 0x04, 0x10})
+	dataStream := parseDataAttribute(attribute, 56, 0, 0, 4096, 0)
+	if(!dataStream.IsCompressed || dataStream.CompressionUnit != 4){
+		t.Fatalf("got compressed %t, unit %d", dataStream.IsCompressed, dataStream.CompressionUnit)
+	}
+}
+
+// Writes an MBR or EBR sector at the given LBA, with a partition entry (type and LBA relative to the sector it is defined in) per pair
+func putMBRSector(disk []byte, LBA int, entries ...[2]uint32){
+	sector := disk[LBA*512:(LBA + 1)*512]
+	for i, entry := range entries{
+		sector[446 + i*16 + 4] = byte(entry[0])
+		binary.LittleEndian.PutUint32(sector[446 + i*16 + 8:446 + i*16 + 12], entry[1])
+		binary.LittleEndian.PutUint32(sector[446 + i*16 + 12:446 + i*16 + 16], 1)
+	}
+	sector[510], sector[511] = 0x55, 0xAA
+}
+
+// A primary NTFS partition and an extended partition at LBA 4096 with two logical partitions, the second EBR links to the given LBA
+func newMBRDisk(t *testing.T, lastEBRLink uint32) string{
+	disk := make([]byte, 4200*512)
+	putMBRSector(disk, 0, [2]uint32{0x07, 2048}, [2]uint32{0x0F, 4096})
+	putMBRSector(disk, 4096, [2]uint32{0x07, 63}, [2]uint32{0x05, 100})
+	putMBRSector(disk, 4196, [2]uint32{0x07, 63}, [2]uint32{0x05, lastEBRLink})
+	driveLocation := filepath.Join(t.TempDir(), "disk.img")
+	if err := os.WriteFile(driveLocation, disk, 0644); err != nil{
+		t.Fatal(err)
+	}
+	return driveLocation
+}
+
+func TestParseMBRPartitionsEBRChain(t *testing.T){
+	tests := map[string]uint32{
+		"EBR linking back to the first one": 0,
+		"EBR linking past the end of the disk": 0x7FFFFFFF,
+	}
+	for name, lastEBRLink := range tests{
+		driveLocation := newMBRDisk(t, lastEBRLink)
+		mbrHeader := ParseMBR(driveLocation, 512)
+		if(!IsValidMBR(mbrHeader) || IsProtectiveMBR(mbrHeader)){
+			t.Fatalf("%s: MBR not recognised", name)
+		}
+		numberOfPartitions, partitions := ParseMBRPartitions(driveLocation, 512)
+		want := []uint32{2048, 4096 + 63, 4196 + 63}
+		if(numberOfPartitions != len(want) || len(partitions) != len(want)){
+			t.Errorf("%s: got %d partitions, want %d", name, numberOfPartitions, len(want))
+			continue
+		}
+		for i, partition := range partitions{
+			if(partition.StartingLBA != want[i]){
+				t.Errorf("%s: partition %d starts at LBA %d, want %d", name, i, partition.StartingLBA, want[i])
+			}
+		}
+	}
+}
+
+func TestParseZoneIdentifier(t *testing.T){
+	utf16Content := append([]byte{0xFF, 0xFE}, encodeUTF16LE("[ZoneTransfer]\r\nZoneId=2\r\n")...)
+	tests := map[string]struct{
+		content []byte
+		want internal.MARK_OF_THE_WEB
+	}{
+		"CRLF with all keys": {[]byte("[ZoneTransfer]\r\nZoneId=3\r\nReferrerUrl=https://example.com/downloads\r\nHostUrl=https://example.com/file.zip?id=1&t=2\r\n"),
+			internal.MARK_OF_THE_WEB{ZoneID: 3, ReferrerUrl: "https://example.com/downloads", HostUrl: "https://example.com/file.zip?id=1&t=2"}},
+		"only ZoneId, LF and UTF-8 BOM": {[]byte("\xEF\xBB\xBF[ZoneTransfer]\nZoneId=3\n"), internal.MARK_OF_THE_WEB{ZoneID: 3}},
+		"missing ZoneId": {[]byte("[ZoneTransfer]\r\nHostUrl=about:internet\r\n"), internal.MARK_OF_THE_WEB{ZoneID: -1, HostUrl: "about:internet"}},
+		"ZoneId that isn't a number": {[]byte("[ZoneTransfer]\r\nZoneId=internet\r\n"), internal.MARK_OF_THE_WEB{ZoneID: -1}},
+		"UTF-16LE": {utf16Content, internal.MARK_OF_THE_WEB{ZoneID: 2}},
+		"empty stream": {nil, internal.MARK_OF_THE_WEB{ZoneID: -1}},
+	}
+	for name, test := range tests{
+		if got := ParseZoneIdentifier(test.content); got != test.want{
+			t.Errorf("%s: got %+v, want %+v", name, got, test.want)
+		}
+	}
+}
+
+// Sets the header fields newFileRecord leaves at their defaults, none of them are covered by the fixups
+func setRecordHeader(record []byte, recordNumber uint32, sequence uint16, isActive bool, baseReference uint64){
+	binary.LittleEndian.PutUint16(record[16:18], sequence)
+	binary.LittleEndian.PutUint16(record[22:24], uint16(internal.BoolToInt(isActive)))
+	binary.LittleEndian.PutUint64(record[32:40], baseReference)
+	binary.LittleEndian.PutUint32(record[44:48], recordNumber)
+}
+
+// A base record (42) whose $ATTRIBUTE_LIST points to an extension record (43) holding a second $FILE_NAME
+func TestResolveAttributeList(t *testing.T){
+	const recordSize = 1024
+	attributeListEntry := make([]byte, 32)
+	binary.LittleEndian.PutUint32(attributeListEntry[0:4], 0x30)
+	binary.LittleEndian.PutUint16(attributeListEntry[4:6], 32)
+	binary.LittleEndian.PutUint64(attributeListEntry[16:24], 43 | 1 << 48)
+	baseAttributes := append(newResidentAttribute(0x20, attributeListEntry), newResidentAttribute(0x30, newFileNameValue("base.txt"))...)
+	extensionAttributes := newResidentAttribute(0x30, newFileNameValue("extension.txt"))
+
+	tests := map[string]struct{
+		baseSequence uint16
+		baseIsActive bool
+		extensionBase uint64
+		wantMerged bool
+	}{
+		"extension of the base record": {3, true, 42 | 3 << 48, true},
+		"stale extension, the base record was reused": {3, true, 42 | 2 << 48, false},
+		"extension of the deleted base record": {4, false, 42 | 3 << 48, true},
+		"stale extension of a deleted base record": {5, false, 42 | 3 << 48, false},
+		"extension of another record": {3, true, 41 | 3 << 48, false},
+	}
+	for name, test := range tests{
+		mftFile := make([]byte, 64*recordSize)
+		baseRecord := newFileRecord(baseAttributes)
+		setRecordHeader(baseRecord, 42, test.baseSequence, test.baseIsActive, 0)
+		copy(mftFile[42*recordSize:], baseRecord)
+		extensionRecord := newFileRecord(extensionAttributes)
+		setRecordHeader(extensionRecord, 43, 1, test.baseIsActive, test.extensionBase)
+		copy(mftFile[43*recordSize:], extensionRecord)
+		driveLocation := filepath.Join(t.TempDir(), "MFT")
+		if err := os.WriteFile(driveLocation, mftFile, 0644); err != nil{
+			t.Fatal(err)
+		}
+		volume := internal.VOLUME_INFO{StandaloneMFT: true, MFTBlocks: []internal.DATA_RUN{{ClusterCount: 64}}}
+
+		fileInformation := ParseMFTRecord(mftFile[42*recordSize:43*recordSize], 42*recordSize, 0, 0, 0)
+		if(fileInformation.IsCorrupt || !fileInformation.HasAttributeList || len(ParseAttributeList(fileInformation.AttributeList.ResidentData, 42)) != 1){
+			t.Fatalf("%s: base record not parsed: %+v", name, fileInformation)
+		}
+		ResolveAttributeList(driveLocation, volume, recordSize, &fileInformation)
+		merged := len(fileInformation.FileNames) == 2 && fileInformation.FileNames[1].Name == "extension.txt"
+		if(merged != test.wantMerged || len(fileInformation.FileNames) != 1 + internal.BoolToInt(test.wantMerged)){
+			t.Errorf("%s: got names %+v, want the extension merged %t", name, fileInformation.FileNames, test.wantMerged)
+		}
+	}
+}
+
+func encodeUTF16LE(text string) []byte{
+	var encoded []byte
+	for _, character := range text{
+		encoded = append(encoded, byte(character), 0)
+	}
+	return encoded
+}
+
+// Reparse data of a junction (mount point) or symbolic link: the substitute name followed by the print name in the path buffer
+func newLinkReparseData(tag uint32, substituteName string, printName string, flags uint32) []byte{
+	substitute := encodeUTF16LE(substituteName)
+	printNameBytes := encodeUTF16LE(printName)
+	reparseData := make([]byte, 16)
+	binary.LittleEndian.PutUint32(reparseData[0:4], tag)
+	binary.LittleEndian.PutUint16(reparseData[10:12], uint16(len(substitute)))
+	binary.LittleEndian.PutUint16(reparseData[12:14], uint16(len(substitute)))
+	binary.LittleEndian.PutUint16(reparseData[14:16], uint16(len(printNameBytes)))
+	if(tag == internal.ReparseTagSymlink){
+		reparseData = binary.LittleEndian.AppendUint32(reparseData, flags)
+	}
+	reparseData = append(append(reparseData, substitute...), printNameBytes...)
+	binary.LittleEndian.PutUint16(reparseData[4:6], uint16(len(reparseData) - 8))
+	return reparseData
+}
+
+func TestParseReparsePoint(t *testing.T){
+	badSymlinkOffset := newLinkReparseData(internal.ReparseTagSymlink, `\??\C:\target`, `C:\target`, 0)
+	binary.LittleEndian.PutUint16(badSymlinkOffset[8:10], 0xFFF0)
+	badJunctionLength := newLinkReparseData(internal.ReparseTagMountPoint, `\??\C:\Users`, `C:\Users`, 0)
+	binary.LittleEndian.PutUint16(badJunctionLength[10:12], 0x200)
+	tests := map[string]struct{
+		reparseData []byte
+		want internal.REPARSE_POINT
+	}{
+		"junction": {newLinkReparseData(internal.ReparseTagMountPoint, `\??\C:\Users`, `C:\Users`, 0),
+			internal.REPARSE_POINT{Tag: internal.ReparseTagMountPoint, TargetPath: `\??\C:\Users`, PrintName: `C:\Users`}},
+		"relative symbolic link": {newLinkReparseData(internal.ReparseTagSymlink, `..\target`, `..\target`, 1),
+			internal.REPARSE_POINT{Tag: internal.ReparseTagSymlink, TargetPath: `..\target`, PrintName: `..\target`, IsRelative: true}},
+		"symbolic link with the substitute name past the end": {badSymlinkOffset,
+			internal.REPARSE_POINT{Tag: internal.ReparseTagSymlink, PrintName: `C:\target`}},
+		"junction with a substitute name longer than the data": {badJunctionLength,
+			internal.REPARSE_POINT{Tag: internal.ReparseTagMountPoint, PrintName: `C:\Users`}},
+		"symbolic link cut off in its header": {newLinkReparseData(internal.ReparseTagSymlink, `C:\target`, `C:\target`, 0)[:18],
+			internal.REPARSE_POINT{Tag: internal.ReparseTagSymlink}},
+	}
+	for name, test := range tests{
+		var fileInformation internal.FILE_INFO
+		parseReparsePoint(test.reparseData, &fileInformation)
+		if(!fileInformation.HasReparsePoint || fileInformation.ReparsePoint != test.want){
+			t.Errorf("%s: got %+v, want %+v", name, fileInformation.ReparsePoint, test.want)
+		}
+	}
+}
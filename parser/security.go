@@ -0,0 +1,252 @@
+package parser
+
+import "bytes"
+import "encoding/binary"
+import "errors"
+import "fmt"
+import "strings"
+import "MFS2SQL/internal"
+
+// $Secure is always record 9, its $SDS stream holds every security descriptor of the volume once.
+// Files refer to a descriptor by the security ID in their $STANDARD_INFORMATION.
+const secureRecordNumber = 9
+
+// Reads and parses $Secure:$SDS, the $MFT runs of the volume have to be known already
+func LoadSecurityDescriptors(driveLocation string, volume internal.VOLUME_INFO, recordSize int64) (map[uint32]internal.SECURITY_DESCRIPTOR, error){
+	recordBuffer, recordOffset, ok := ReadMFTRecord(driveLocation, volume.MFTBlocks, volume.NTFSOffset, volume.ClusterSize, recordSize, secureRecordNumber)
+	if(!ok){
+		return nil, errors.New("unable to read the $Secure record")
+	}
+	secureFile := ParseMFTRecord(recordBuffer, recordOffset, volume.NTFSOffset, volume.ClusterSize, 0)
+	ResolveAttributeList(driveLocation, volume, recordSize, &secureFile)
+	sdsStream, ok := SelectStream(secureFile, "$SDS")
+	if(secureFile.IsCorrupt || !ok){
+		return nil, errors.New("$Secure has no $SDS stream")
+	}
+	sdsContent := sdsStream.ResidentData
+	if(!sdsStream.IsResident){
+		var sdsBuffer bytes.Buffer
+		if _, err := ReadDataRuns(driveLocation, sdsStream.DataRuns, volume.NTFSOffset, volume.ClusterSize, sdsStream.DataLength, &sdsBuffer); err != nil{
+			return nil, err
+		}
+		sdsContent = sdsBuffer.Bytes()
+	}
+	return ParseSecurityDescriptorStream(sdsContent), nil
+}
+
+// $SDS entries: hash, security ID, offset of the entry within the stream, entry length, followed by the descriptor, aligned to 16 bytes.
+// The stream is written in 256KB blocks that are each followed by a mirror copy, the offset field only matches in the original.
+// https://flatcap.github.io/linux-ntfs/ntfs/files/secure.html
+func ParseSecurityDescriptorStream(sdsContent []byte) map[uint32]internal.SECURITY_DESCRIPTOR{
+	const entryHeaderSize = 20
+	securityDescriptors := make(map[uint32]internal.SECURITY_DESCRIPTOR)
+	for offset := 0; offset + entryHeaderSize <= len(sdsContent); {
+		securityID := binary.LittleEndian.Uint32(sdsContent[offset + 4:offset + 8])
+		entryOffset := binary.LittleEndian.Uint64(sdsContent[offset + 8:offset + 16])
+		entryLength := int(binary.LittleEndian.Uint32(sdsContent[offset + 16:offset + 20]))
+		if(entryOffset != uint64(offset) || entryLength <= entryHeaderSize || offset + entryLength > len(sdsContent)){
+			offset = offset + 16
+			continue
+		}
+		if _, seen := securityDescriptors[securityID]; !seen{
+			if securityDescriptor, ok := ParseSecurityDescriptor(sdsContent[offset + entryHeaderSize:offset + entryLength]); ok{
+				securityDescriptor.SecurityID = securityID
+				securityDescriptors[securityID] = securityDescriptor
+			}
+		}
+		offset = offset + (entryLength + 15) &^ 15
+	}
+	return securityDescriptors
+}
+
+// Self-relative SECURITY_DESCRIPTOR: revision, padding, control flags and the offsets of the owner, group, SACL and DACL
+// https://learn.microsoft.com/en-us/openspecs/windows_protocols/ms-dtyp/7d4dac05-9cef-4563-a058-f108abecce1d
+func ParseSecurityDescriptor(descriptor []byte) (internal.SECURITY_DESCRIPTOR, bool){
+	const sePresentDACL = 0x0004
+	const sePresentSACL = 0x0010
+	var securityDescriptor internal.SECURITY_DESCRIPTOR
+	if(len(descriptor) < 20 || descriptor[0] != 1){
+		return securityDescriptor, false
+	}
+	securityDescriptor.Control = binary.LittleEndian.Uint16(descriptor[2:4])
+	ownerOffset := int(binary.LittleEndian.Uint32(descriptor[4:8]))
+	groupOffset := int(binary.LittleEndian.Uint32(descriptor[8:12]))
+	saclOffset := int(binary.LittleEndian.Uint32(descriptor[12:16]))
+	daclOffset := int(binary.LittleEndian.Uint32(descriptor[16:20]))
+	if(ownerOffset != 0){
+		securityDescriptor.OwnerSID, _ = parseSID(descriptor, ownerOffset)
+	}
+	if(groupOffset != 0){
+		securityDescriptor.GroupSID, _ = parseSID(descriptor, groupOffset)
+	}
+	if(securityDescriptor.Control & sePresentDACL != 0 && daclOffset != 0){
+		securityDescriptor.DACL = parseACL(descriptor, daclOffset)
+	}
+	if(securityDescriptor.Control & sePresentSACL != 0 && saclOffset != 0){
+		securityDescriptor.SACL = parseACL(descriptor, saclOffset)
+	}
+	securityDescriptor.SDDL = securityDescriptorToSDDL(securityDescriptor, daclOffset == 0, saclOffset == 0)
+	return securityDescriptor, true
+}
+
+// SID: revision, number of sub authorities, 48-bit big endian identifier authority, little endian 32-bit sub authorities
+func parseSID(buffer []byte, offset int) (string, bool){
+	if(offset < 0 || offset + 8 > len(buffer)){
+		return "", false
+	}
+	subAuthorityCount := int(buffer[offset + 1])
+	if(offset + 8 + subAuthorityCount*4 > len(buffer)){
+		return "", false
+	}
+	var identifierAuthority uint64
+	for _, authorityByte := range buffer[offset + 2:offset + 8]{
+		identifierAuthority = identifierAuthority << 8 | uint64(authorityByte)
+	}
+	sid := fmt.Sprintf("S-%d-%d", buffer[offset], identifierAuthority)
+	if(identifierAuthority >= 1 << 32){
+		sid = fmt.Sprintf("S-%d-0x%012X", buffer[offset], identifierAuthority)
+	}
+	for i := 0; i < subAuthorityCount; i++{
+		sid = sid + fmt.Sprintf("-%d", binary.LittleEndian.Uint32(buffer[offset + 8 + i*4:]))
+	}
+	return sid, true
+}
+
+// ACL header: revision, padding, size, number of ACEs. Every ACE starts with its type, flags and size.
+func parseACL(buffer []byte, offset int) []internal.ACE{
+	var accessControlEntries []internal.ACE
+	if(offset + 8 > len(buffer)){
+		return nil
+	}
+	aceCount := int(binary.LittleEndian.Uint16(buffer[offset + 4:offset + 6]))
+	aceOffset := offset + 8
+	for i := 0; i < aceCount && aceOffset + 8 <= len(buffer); i++{
+		aceSize := int(binary.LittleEndian.Uint16(buffer[aceOffset + 2:aceOffset + 4]))
+		if(aceSize < 8 || aceOffset + aceSize > len(buffer)){
+			break
+		}
+		accessControlEntry := internal.ACE{Type: buffer[aceOffset], Flags: buffer[aceOffset + 1], AccessMask: binary.LittleEndian.Uint32(buffer[aceOffset + 4:aceOffset + 8])}
+		sidOffset := aceOffset + 8
+		// Object ACEs have a flags field telling which of the two object type GUIDs follow, before the SID
+		if(isObjectACE(accessControlEntry.Type) && aceOffset + 12 <= len(buffer)){
+			objectFlags := binary.LittleEndian.Uint32(buffer[aceOffset + 8:aceOffset + 12])
+			sidOffset = aceOffset + 12
+			if(objectFlags & 1 != 0){
+				sidOffset = sidOffset + 16
+			}
+			if(objectFlags & 2 != 0){
+				sidOffset = sidOffset + 16
+			}
+		}
+		accessControlEntry.SID, _ = parseSID(buffer[:aceOffset + aceSize], sidOffset)
+		accessControlEntries = append(accessControlEntries, accessControlEntry)
+		aceOffset = aceOffset + aceSize
+	}
+	return accessControlEntries
+}
+
+func isObjectACE(aceType uint8) bool{
+	return aceType == 5 || aceType == 6 || aceType == 7 || aceType == 8 || aceType == 0x0B || aceType == 0x0C || aceType == 0x0F || aceType == 0x10
+}
+
+/* SDDL rendering, following ConvertSecurityDescriptorToStringSecurityDescriptor: https://learn.microsoft.com/en-us/windows/win32/secauthz/security-descriptor-string-format */
+var sddlACETypes = map[uint8]string{0: "A", 1: "D", 2: "AU", 3: "AL", 5: "OA", 6: "OD", 7: "OU", 8: "OL", 9: "XA", 0x0A: "XD", 0x0D: "XU", 0x11: "ML", 0x12: "RA", 0x13: "SP"}
+
+// ACE flags in the order Windows writes them
+var sddlACEFlags = []struct{flag uint8; alias string}{{0x01, "OI"}, {0x02, "CI"}, {0x04, "NP"}, {0x08, "IO"}, {0x10, "ID"}, {0x40, "SA"}, {0x80, "FA"}}
+
+// Complete file access masks that have their own alias
+var sddlFileRights = map[uint32]string{0x1F01FF: "FA", 0x120089: "FR", 0x120116: "FW", 0x1200A0: "FX"}
+
+// Single rights in the order Windows writes them (e.g. SDGXGWGR), a mask is only written with these when every bit has an alias
+var sddlRights = []struct{mask uint32; alias string}{
+	{0x00000010, "RP"}, {0x00000020, "WP"}, {0x00000100, "CR"}, {0x00000001, "CC"}, {0x00000002, "DC"}, {0x00000004, "LC"},
+	{0x00000080, "LO"}, {0x00020000, "RC"}, {0x00080000, "WO"}, {0x00040000, "WD"}, {0x00010000, "SD"}, {0x00000040, "DT"},
+	{0x00000008, "SW"}, {0x20000000, "GX"}, {0x40000000, "GW"}, {0x80000000, "GR"}, {0x10000000, "GA"},
+}
+
+// Mandatory label ACEs use the access mask as their policy
+var sddlMandatoryLabelRights = []struct{mask uint32; alias string}{{0x1, "NW"}, {0x2, "NR"}, {0x4, "NX"}}
+
+func securityDescriptorToSDDL(securityDescriptor internal.SECURITY_DESCRIPTOR, nullDACL bool, nullSACL bool) string{
+	const sePresentDACL = 0x0004
+	const sePresentSACL = 0x0010
+	var sddl strings.Builder
+	if(securityDescriptor.OwnerSID != ""){
+		sddl.WriteString("O:" + internal.SIDToSDDLAlias(securityDescriptor.OwnerSID))
+	}
+	if(securityDescriptor.GroupSID != ""){
+		sddl.WriteString("G:" + internal.SIDToSDDLAlias(securityDescriptor.GroupSID))
+	}
+	if(securityDescriptor.Control & sePresentDACL != 0){
+		sddl.WriteString("D:" + aclControlToSDDL(securityDescriptor.Control, 0x1000, 0x0400, 0x0100))
+		if(nullDACL){
+			// No DACL at all grants everyone full access
+			sddl.WriteString("NO_ACCESS_CONTROL")
+		}
+		for _, accessControlEntry := range securityDescriptor.DACL{
+			sddl.WriteString(ACEToSDDL(accessControlEntry))
+		}
+	}
+	if(securityDescriptor.Control & sePresentSACL != 0){
+		sddl.WriteString("S:" + aclControlToSDDL(securityDescriptor.Control, 0x2000, 0x0800, 0x0200))
+		if(nullSACL){
+			sddl.WriteString("NO_ACCESS_CONTROL")
+		}
+		for _, accessControlEntry := range securityDescriptor.SACL{
+			sddl.WriteString(ACEToSDDL(accessControlEntry))
+		}
+	}
+	return sddl.String()
+}
+
+// Protected (P), auto inherited (AI) and auto inherit required (AR) flags of a DACL or SACL
+func aclControlToSDDL(control uint16, protectedFlag uint16, autoInheritedFlag uint16, autoInheritRequiredFlag uint16) string{
+	aclFlags := ""
+	if(control & protectedFlag != 0){
+		aclFlags = aclFlags + "P"
+	}
+	if(control & autoInheritRequiredFlag != 0){
+		aclFlags = aclFlags + "AR"
+	}
+	if(control & autoInheritedFlag != 0){
+		aclFlags = aclFlags + "AI"
+	}
+	return aclFlags
+}
+
+// One ACE as (type;flags;rights;object guid;inherit object guid;sid), the object GUIDs are left empty
+func ACEToSDDL(accessControlEntry internal.ACE) string{
+	aceType, ok := sddlACETypes[accessControlEntry.Type]
+	if(!ok){
+		aceType = fmt.Sprintf("0x%x", accessControlEntry.Type)
+	}
+	aceFlags := ""
+	for _, sddlFlag := range sddlACEFlags{
+		if(accessControlEntry.Flags & sddlFlag.flag != 0){
+			aceFlags = aceFlags + sddlFlag.alias
+		}
+	}
+	return fmt.Sprintf("(%s;%s;%s;;;%s)", aceType, aceFlags, accessMaskToSDDL(accessControlEntry), internal.SIDToSDDLAlias(accessControlEntry.SID))
+}
+
+func accessMaskToSDDL(accessControlEntry internal.ACE) string{
+	rights := sddlRights
+	if(accessControlEntry.Type == 0x11){
+		rights = sddlMandatoryLabelRights
+	} else if alias, ok := sddlFileRights[accessControlEntry.AccessMask]; ok{
+		return alias
+	}
+	aliases := ""
+	remainingMask := accessControlEntry.AccessMask
+	for _, right := range rights{
+		if(remainingMask & right.mask != 0){
+			aliases = aliases + right.alias
+			remainingMask = remainingMask &^ right.mask
+		}
+	}
+	if(remainingMask != 0 || aliases == ""){
+		return fmt.Sprintf("0x%x", accessControlEntry.AccessMask)
+	}
+	return aliases
+}
@@ -0,0 +1,122 @@
+package parser
+
+import "encoding/binary"
+import "testing"
+
+func newSID(authority byte, subAuthorities ...uint32) []byte{
+	sid := []byte{1, byte(len(subAuthorities)), 0, 0, 0, 0, 0, authority}
+	for _, subAuthority := range subAuthorities{
+		sid = binary.LittleEndian.AppendUint32(sid, subAuthority)
+	}
+	return sid
+}
+
+func newACE(aceType uint8, flags uint8, accessMask uint32, sid []byte) []byte{
+	ace := []byte{aceType, flags, 0, 0}
+	binary.LittleEndian.PutUint16(ace[2:4], uint16(8 + len(sid)))
+	ace = binary.LittleEndian.AppendUint32(ace, accessMask)
+	return append(ace, sid...)
+}
+
+// Self-relative descriptor with an owner, a group and a DACL holding the given ACEs
+func newSecurityDescriptor(control uint16, owner []byte, group []byte, aces ...[]byte) []byte{
+	descriptor := make([]byte, 20)
+	descriptor[0] = 1
+	binary.LittleEndian.PutUint16(descriptor[2:4], control)
+	binary.LittleEndian.PutUint32(descriptor[4:8], uint32(len(descriptor)))
+	descriptor = append(descriptor, owner...)
+	binary.LittleEndian.PutUint32(descriptor[8:12], uint32(len(descriptor)))
+	descriptor = append(descriptor, group...)
+	binary.LittleEndian.PutUint32(descriptor[16:20], uint32(len(descriptor)))
+	acl := make([]byte, 8)
+	acl[0] = 2
+	for _, ace := range aces{
+		acl = append(acl, ace...)
+	}
+	binary.LittleEndian.PutUint16(acl[2:4], uint16(len(acl)))
+	binary.LittleEndian.PutUint16(acl[4:6], uint16(len(aces)))
+	return append(descriptor, acl...)
+}
+
+const (
+	controlSelfRelative = 0x8000
+	controlDACLProtected = 0x1000
+	controlDACLAutoInherited = 0x0400
+	controlDACLPresent = 0x0004
+)
+
+var (
+	sidAdministrators = newSID(5, 32, 544)
+	sidLocalSystem = newSID(5, 18)
+	sidUsers = newSID(5, 32, 545)
+)
+
+func TestParseSecurityDescriptor(t *testing.T){
+	descriptor := newSecurityDescriptor(controlSelfRelative | controlDACLProtected | controlDACLAutoInherited | controlDACLPresent, sidAdministrators, sidLocalSystem,
+		newACE(0, 0, 0x001F01FF, sidLocalSystem))
+	securityDescriptor, ok := ParseSecurityDescriptor(descriptor)
+	if(!ok){
+		t.Fatal("descriptor was rejected")
+	}
+	if(securityDescriptor.OwnerSID != "S-1-5-32-544" || securityDescriptor.GroupSID != "S-1-5-18" || len(securityDescriptor.DACL) != 1){
+		t.Fatalf("got %+v", securityDescriptor)
+	}
+	if(securityDescriptor.SDDL != "O:BAG:SYD:PAI(A;;FA;;;SY)"){
+		t.Fatalf("got SDDL %s", securityDescriptor.SDDL)
+	}
+}
+
+// $SDS entry: hash, security ID, offset of the entry within the stream, entry length and the descriptor, padded to 16 bytes
+func appendSDSEntry(sdsContent []byte, securityID uint32, entryOffset int, descriptor []byte) []byte{
+	entry := make([]byte, 20)
+	binary.LittleEndian.PutUint32(entry[4:8], securityID)
+	binary.LittleEndian.PutUint64(entry[8:16], uint64(entryOffset))
+	binary.LittleEndian.PutUint32(entry[16:20], uint32(20 + len(descriptor)))
+	entry = append(entry, descriptor...)
+	for(len(entry) % 16 != 0){
+		entry = append(entry, 0)
+	}
+	return append(sdsContent, entry...)
+}
+
+// The stream is written in blocks of 256KB, each followed by a mirror copy whose entries still carry the offset of the original
+func TestParseSecurityDescriptorStream(t *testing.T){
+	const blockSize = 0x40000
+	descriptors := map[uint32][]byte{
+		0x100: newSecurityDescriptor(controlSelfRelative | controlDACLPresent, sidAdministrators, sidLocalSystem, newACE(0, 0x03, 0x001F01FF, sidAdministrators)),
+		0x101: newSecurityDescriptor(controlSelfRelative | controlDACLPresent, sidUsers, sidUsers, newACE(1, 0, 0x00010000, sidUsers), newACE(0, 0x10, 0x001200A9, sidUsers)),
+		0x102: newSecurityDescriptor(controlSelfRelative | controlDACLProtected | controlDACLAutoInherited | controlDACLPresent, sidAdministrators, sidLocalSystem, newACE(0, 0, 0x001F01FF, sidLocalSystem)),
+	}
+	var sdsContent []byte
+	sdsContent = appendSDSEntry(sdsContent, 0x100, len(sdsContent), descriptors[0x100])
+	// The first descriptor doesn't end on a 16 byte boundary, the second entry starts after the padding
+	if((20 + len(descriptors[0x100])) % 16 == 0){
+		t.Fatal("test descriptor doesn't need padding")
+	}
+	sdsContent = appendSDSEntry(sdsContent, 0x101, len(sdsContent), descriptors[0x101])
+	firstBlock := append([]byte(nil), sdsContent...)
+	sdsContent = append(sdsContent, make([]byte, blockSize - len(sdsContent))...)
+	// The mirror of the first block, its entries would only be parsed if the offset field wasn't checked
+	mirror := append([]byte(nil), firstBlock...)
+	secondEntry := (20 + len(descriptors[0x100]) + 15) &^ 15
+	binary.LittleEndian.PutUint32(mirror[secondEntry + 4:secondEntry + 8], 0x1FF)
+	sdsContent = append(sdsContent, mirror...)
+	sdsContent = append(sdsContent, make([]byte, 2*blockSize - len(sdsContent))...)
+	sdsContent = appendSDSEntry(sdsContent, 0x102, len(sdsContent), descriptors[0x102])
+
+	securityDescriptors := ParseSecurityDescriptorStream(sdsContent)
+	if(len(securityDescriptors) != len(descriptors)){
+		t.Fatalf("got %d descriptors, want %d", len(securityDescriptors), len(descriptors))
+	}
+	want := map[uint32]string{
+		0x100: "O:BAG:SYD:(A;OICI;FA;;;BA)",
+		0x101: "O:BUG:BUD:(D;;SD;;;BU)(A;ID;0x1200a9;;;BU)",
+		0x102: "O:BAG:SYD:PAI(A;;FA;;;SY)",
+	}
+	for securityID, sddl := range want{
+		got, found := securityDescriptors[securityID]
+		if(!found || got.SecurityID != securityID || got.SDDL != sddl){
+			t.Errorf("security ID %#x: got %q, want %q", securityID, got.SDDL, sddl)
+		}
+	}
+}